@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"portfolio/internal/checker"
+)
+
+// runCheck implements "portfolio check": it validates every link in the
+// built site and exits with status 1 if any are broken.
+func runCheck(args []string) int {
+	fs := newFlagSet("check", "")
+	opts := checker.Options{}
+	var allow string
+	fs.StringVar(&opts.Dir, "out", "docs", "built site directory to check")
+	fs.StringVar(&opts.BaseURL, "base-url", defaultConfig().BaseURL, "site URL; absolute links to it are checked as internal")
+	fs.BoolVar(&opts.External, "external", false, "also check external http(s) links")
+	fs.StringVar(&allow, "allow", "", "comma-separated hosts to check externally (default: all)")
+	fs.StringVar(&opts.CacheFile, "cache", ".linkcheck-cache.json", "external results cache file")
+	fs.DurationVar(&opts.CacheTTL, "cache-ttl", 24*time.Hour, "how long cached external results are trusted")
+	fs.DurationVar(&opts.PerHostRate, "rate", time.Second, "minimum delay between requests to one host")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "timeout per external request")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if allow != "" {
+		opts.AllowHosts = strings.Split(allow, ",")
+	}
+
+	problems, err := checker.Check(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "check:", err)
+		return exitError
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d broken link(s)\n", len(problems))
+		return exitError
+	}
+	fmt.Println("All links OK")
+	return exitOK
+}
@@ -2,39 +2,186 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
+	"syscall"
 
 	"portfolio/internal/builder"
 )
 
 const reloadScript = `<script>
 (function() {
+	var scrollKey = 'dev-scroll:' + location.pathname;
+	var saved = sessionStorage.getItem(scrollKey);
+	if (saved) {
+		sessionStorage.removeItem(scrollKey);
+		var pos = JSON.parse(saved);
+		window.addEventListener('load', function() { window.scrollTo(pos.x, pos.y); });
+	}
+	function reloadKeepingScroll() {
+		sessionStorage.setItem(scrollKey, JSON.stringify({ x: window.scrollX, y: window.scrollY }));
+		location.reload();
+	}
+
 	var es = new EventSource('/live-reload');
-	es.onmessage = function(e) {
-		if (e.data === 'reload') { location.reload(); }
-	};
+	es.addEventListener('css', function() { clearBuildError(); swapStylesheets(); });
+	es.addEventListener('page', reloadKeepingScroll);
+	es.addEventListener('full', function() { location.reload(); });
+	es.addEventListener('build-error', function(e) { showBuildError(JSON.parse(e.data)); });
 	es.onerror = function() {
-		setTimeout(function() { location.reload(); }, 1000);
+		setTimeout(reloadKeepingScroll, 1000);
 	};
+
+	// Stylesheet names are fingerprinted, so fetch the rebuilt page to learn
+	// the new URLs and swap each changed <link> once its replacement loads.
+	function swapStylesheets() {
+		fetch(location.href, { cache: 'no-store' })
+			.then(function(r) { return r.text(); })
+			.then(function(html) {
+				var doc = new DOMParser().parseFromString(html, 'text/html');
+				var fresh = doc.querySelectorAll('link[rel="stylesheet"]');
+				var current = document.querySelectorAll('link[rel="stylesheet"]');
+				fresh.forEach(function(link, i) {
+					var old = current[i];
+					if (!old || old.getAttribute('href') === link.getAttribute('href')) return;
+					var next = document.importNode(link, true);
+					next.onload = function() { old.remove(); };
+					old.after(next);
+				});
+			})
+			.catch(reloadKeepingScroll);
+	}
+
+	function clearBuildError() {
+		var old = document.getElementById('dev-error-overlay');
+		if (old) old.remove();
+	}
+
+	function showBuildError(err) {
+		clearBuildError();
+		var box = document.createElement('div');
+		box.id = 'dev-error-overlay';
+		box.setAttribute('role', 'alertdialog');
+		box.setAttribute('aria-label', 'Build error');
+		box.style.cssText = 'position:fixed;inset:0;z-index:2147483647;background:rgba(15,15,20,.88);color:#f8f8f2;font:14px/1.5 ui-monospace,monospace;padding:48px;overflow:auto';
+		var title = document.createElement('h2');
+		title.textContent = 'Build failed';
+		title.style.cssText = 'color:#ff6b6b;font-size:20px;margin:0 0 8px';
+		var where = document.createElement('p');
+		where.textContent = err.file ? err.file + (err.line ? ':' + err.line : '') : '';
+		where.style.cssText = 'color:#8be9fd;margin:0 0 16px';
+		var msg = document.createElement('pre');
+		msg.textContent = err.message;
+		msg.style.cssText = 'white-space:pre-wrap;margin:0';
+		var close = document.createElement('button');
+		close.textContent = '×';
+		close.setAttribute('aria-label', 'Dismiss');
+		close.style.cssText = 'position:absolute;top:16px;right:24px;background:none;border:0;color:inherit;font-size:28px;cursor:pointer';
+		close.onclick = function() { box.remove(); };
+		box.append(close, title, where, msg);
+		document.body.appendChild(box);
+	}
 })();
 </script>`
 
+// devEvent is a message pushed to browsers over /live-reload.
+type devEvent struct {
+	Name    string `json:"-"` // SSE event name: a reload kind or "build-error"
+	Message string `json:"message,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// templateErrRe extracts the location from html/template errors such as
+// `template: blog_post.html:12:3: executing "blog_post" at <.Foo>: ...`.
+var templateErrRe = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+
 var (
 	clientsMu sync.Mutex
-	clients   = map[chan struct{}]struct{}{}
+	clients   = map[chan devEvent]struct{}{}
+	lastError *devEvent // current build error, replayed to new clients
 )
 
-func runDevServer(cfg builder.Config) {
+// serverOptions configures where the dev server listens.
+type serverOptions struct {
+	Host string // host name used in printed and generated URLs
+	Port int    // first port to try
+	Bind string // listen address; defaults to Host
+	Open bool   // launch a browser once listening
+}
+
+// maxPortTries bounds the search for a free port above serverOptions.Port.
+const maxPortTries = 20
+
+// devOutputDir is where serve builds the site by default. Its pages link to
+// the dev server, so they must not end up in the production output.
+const devOutputDir = ".dev-site"
+
+// runServe implements "portfolio serve".
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "")
+	cfg := siteFlags(fs)
+	cfg.OutputDir = devOutputDir
+	fs.Lookup("out").DefValue = devOutputDir
+	var opts serverOptions
+	fs.StringVar(&opts.Host, "host", "localhost", "host name used in URLs")
+	fs.IntVar(&opts.Port, "port", 8080, "port to listen on (the next free port is used if taken)")
+	fs.StringVar(&opts.Bind, "bind", "", "listen address, e.g. 0.0.0.0 for LAN preview (default: host)")
+	fs.BoolVar(&opts.Open, "open", false, "open the site in a browser")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	cfg.Minify = false
+	if err := runDevServer(*cfg, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "serve:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runDevServer(cfg builder.Config, opts serverOptions) error {
+	ln, err := listen(opts)
+	if err != nil {
+		return err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port != opts.Port {
+		log.Printf("port %d is in use, using %d", opts.Port, port)
+	}
+
+	// Generated pages link to the dev server, not production.
+	host := opts.Host
+	if isUnspecified(opts.Bind) && host == "localhost" {
+		if ip := lanIP(); ip != "" {
+			host = ip // reachable from phones on the same network
+		}
+	}
+	siteURL := "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.BaseURL = siteURL
+
+	// Read templates and static files from disk so edits show up without
+	// restarting the server.
+	cfg.LiveDir = filepath.Join("internal", "renderer")
+
 	// Initial build
 	if err := builder.Build(cfg); err != nil {
 		log.Printf("initial build error: %v", err)
+		broadcastError(err)
 	} else {
 		log.Println("initial build done")
 	}
@@ -44,11 +191,71 @@ func runDevServer(cfg builder.Config) {
 
 	// Routes
 	http.Handle("/live-reload", http.HandlerFunc(sseHandler))
-	http.Handle("/", injectMiddleware(http.FileServer(http.Dir(cfg.OutputDir))))
+	http.Handle("/", injectMiddleware(precompressed(cfg.OutputDir, http.FileServer(http.Dir(cfg.OutputDir)))))
+
+	log.Printf("dev server listening on %s/", siteURL)
+	if host != opts.Host {
+		log.Printf("  local: http://%s/", net.JoinHostPort(opts.Host, strconv.Itoa(port)))
+	}
+	if opts.Open {
+		if err := openBrowser(siteURL + "/"); err != nil {
+			log.Printf("opening browser: %v", err)
+		}
+	}
+	return http.Serve(ln, nil)
+}
+
+// listen binds the first free port starting at opts.Port.
+func listen(opts serverOptions) (net.Listener, error) {
+	bind := opts.Bind
+	if bind == "" {
+		bind = opts.Host
+	}
+	var err error
+	for port := opts.Port; port < opts.Port+maxPortTries; port++ {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no free port in %d-%d: %w", opts.Port, opts.Port+maxPortTries-1, err)
+}
+
+func isUnspecified(bind string) bool {
+	if bind == "" {
+		return false
+	}
+	ip := net.ParseIP(bind)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// lanIP returns the first non-loopback IPv4 address of this machine.
+func lanIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok && !ipn.IP.IsLoopback() && ipn.IP.To4() != nil {
+			return ipn.IP.String()
+		}
+	}
+	return ""
+}
 
-	log.Println("dev server listening on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
+// openBrowser opens url with the platform's default handler.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
 	}
 }
 
@@ -57,9 +264,12 @@ func sseHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ch := make(chan struct{}, 1)
+	ch := make(chan devEvent, 4)
 	clientsMu.Lock()
 	clients[ch] = struct{}{}
+	if lastError != nil {
+		ch <- *lastError
+	}
 	clientsMu.Unlock()
 
 	defer func() {
@@ -78,24 +288,93 @@ func sseHandler(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			return
-		case <-ch:
-			fmt.Fprint(w, "data: reload\n\n")
+		case ev := <-ch:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, data)
 			flusher.Flush()
 		}
 	}
 }
 
-func broadcast() {
+// Reload kinds sent after a successful build, from least to most disruptive.
+const (
+	reloadCSS  = "css"  // swap stylesheets in place
+	reloadPage = "page" // reload, keeping the scroll position
+	reloadFull = "full" // reload from the top
+)
+
+// broadcast tells every connected browser how to pick up a successful
+// build and clears any error overlay left by a previous failed one.
+func broadcast(kind string) {
+	clientsMu.Lock()
+	lastError = nil
+	clientsMu.Unlock()
+	send(devEvent{Name: kind})
+}
+
+// reloadKind decides how browsers should apply a rebuild caused by changed:
+// stylesheet edits are hot-swapped, content and template edits reload the
+// page in place, and anything else reloads from scratch.
+func reloadKind(cfg builder.Config, changed []string) string {
+	kind := reloadCSS
+	for _, p := range changed {
+		switch ext := filepath.Ext(p); {
+		case ext == ".css":
+		case ext == ".md" && isUnder(p, cfg.ContentDir),
+			ext == ".html" && isUnder(p, cfg.LiveDir):
+			kind = reloadPage
+		default:
+			return reloadFull
+		}
+	}
+	return kind
+}
+
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// broadcastError shows err in the browser overlay until the next good build.
+func broadcastError(err error) {
+	ev := devEvent{Name: "build-error", Message: err.Error()}
+	ev.File, ev.Line = errorLocation(err)
+	clientsMu.Lock()
+	lastError = &ev
+	clientsMu.Unlock()
+	send(ev)
+}
+
+func send(ev devEvent) {
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 	for ch := range clients {
 		select {
-		case ch <- struct{}{}:
+		case ch <- ev:
 		default:
 		}
 	}
 }
 
+// errorLocation does its best to find the source file and line of a build
+// error for the overlay. The line is 0 when unknown.
+func errorLocation(err error) (string, int) {
+	var located interface{ Location() (string, int) }
+	if errors.As(err, &located) {
+		file, line := located.Location()
+		return filepath.ToSlash(file), line
+	}
+	if m := templateErrRe.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return filepath.ToSlash(filepath.Join("internal", "renderer", "templates", m[1])), line
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return filepath.ToSlash(pathErr.Path), 0
+	}
+	return "", 0
+}
+
 type bufferedWriter struct {
 	http.ResponseWriter
 	buf    bytes.Buffer
@@ -128,55 +407,63 @@ func injectMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func watchFiles(cfg builder.Config) {
-	snapshots := map[string]time.Time{}
-
-	// Seed initial snapshot
-	_ = takeSnapshot([]string{cfg.ContentDir, "internal"}, snapshots)
-
-	ticker := time.NewTicker(300 * time.Millisecond)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		newSnap := map[string]time.Time{}
-		_ = takeSnapshot([]string{cfg.ContentDir, "internal"}, newSnap)
-
-		if changed(snapshots, newSnap) {
-			snapshots = newSnap
-			if err := builder.Build(cfg); err != nil {
-				log.Printf("rebuild error: %v", err)
-			} else {
-				log.Println("rebuilt")
-				broadcast()
-			}
+// precompressed serves the .gz sibling written by the build when the client
+// accepts gzip, mirroring nginx's gzip_static. HTML is left uncompressed
+// because injectMiddleware has to rewrite it.
+func precompressed(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = filepath.Join(name, "index.html")
 		}
-	}
-}
-
-func takeSnapshot(dirs []string, snap map[string]time.Time) error {
-	for _, dir := range dirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			snap[path] = info.ModTime()
-			return nil
-		})
+		ext := filepath.Ext(name)
+		if ext == ".html" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		f, err := os.Open(name + ".gz")
 		if err != nil {
-			return err
+			next.ServeHTTP(w, r)
+			return
 		}
-	}
-	return nil
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ct := mime.TypeByExtension(ext); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
 }
 
-func changed(old, new map[string]time.Time) bool {
-	if len(old) != len(new) {
-		return true
-	}
-	for k, v := range new {
-		if ov, ok := old[k]; !ok || !ov.Equal(v) {
-			return true
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, by name
+// or through "*", with a non-zero quality: "gzip;q=0" refuses it.
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
 		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
 	}
-	return false
+	return anyQ > 0
 }
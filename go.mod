@@ -2,4 +2,4 @@ module portfolio
 
 go 1.25.0
 
-require github.com/yuin/goldmark v1.7.16 // indirect
+require github.com/yuin/goldmark v1.7.16
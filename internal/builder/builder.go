@@ -1,11 +1,15 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
+	"portfolio/internal/i18n"
 	"portfolio/internal/model"
 	"portfolio/internal/parser"
 	"portfolio/internal/renderer"
@@ -13,28 +17,82 @@ import (
 
 // Config holds the input/output directories for the build.
 type Config struct {
-	ContentDir string // e.g. "content"
-	OutputDir  string // e.g. "docs"
+	ContentDir string                 // e.g. "content"
+	OutputDir  string                 // e.g. "docs"
+	BaseURL    string                 // absolute site root, e.g. "https://rainyinsaigon.github.io"
+	Drafts     bool                   // include posts and pages marked draft: true
+	AssetDirs  []string               // extra fingerprinted assets, e.g. "assets/dist"
+	LiveDir    string                 // dev only: read renderer templates/static from here, e.g. "internal/renderer"
+	Minify     bool                   // minify output files (off for the dev server)
+	Gzip       bool                   // write .gz siblings for compressible files
+	GzipMin    int64                  // smallest file size worth compressing, in bytes
+	VendorDir  string                 // cache for third-party assets, e.g. "third_party"
+	Vendor     []renderer.VendorAsset // third-party assets served from /vendor/
+	Related    RelatedConfig          // scoring of the related posts list
+	Languages  []renderer.Language    // site languages, default first
+	I18nDir    string                 // translated UI strings, <lang>.yaml, e.g. "i18n"
+	TimeZone   string                 // zone of dates without an offset, e.g. "Asia/Ho_Chi_Minh"; "" is UTC
+	Repo       string                 // GitHub repository for "view source" links, "" for none
+	Branch     string                 // branch of Repo the site is built from, e.g. "main"
+	History    bool                   // list the commits that touched each post under it
+	Diagrams   map[string][]string    // fenced code language → command that turns it into SVG, e.g. "dot": {"dot", "-Tsvg"}
+	DiagramDir string                 // cache of drawn diagrams, e.g. "diagram-cache"; "" to always redraw
+	Shortcodes string                 // user shortcode templates, <name>.html, e.g. "layouts/shortcodes"
+	HTML       parser.HTMLPolicy      // what happens to raw HTML in markdown; the zero value strips it
 }
 
-// Build parses all content, sorts it, and renders the full site.
-func Build(cfg Config) error {
-	// Parse content
-	posts, err := parser.ReadPosts(filepath.Join(cfg.ContentDir, "posts"))
-	if err != nil {
-		return fmt.Errorf("reading posts: %w", err)
+// ErrRestartRequired is returned by Rebuild when the only changes are to
+// files compiled into the binary, which a running process cannot pick up.
+var ErrRestartRequired = errors.New("Go sources changed; restart to apply")
+
+// Rebuild rebuilds the site after the given source paths changed, e.g. as
+// reported by the dev server's file watcher. Only parsing is incremental:
+// posts whose files are not in changed are reused from the previous build
+// instead of being re-parsed, but every page, list, feed and sitemap is
+// rendered and written again, since one post can change many of them
+// (related posts, tags, series). Rendering is fast; markdown conversion, with
+// its diagram commands, is what the cache saves.
+func Rebuild(cfg Config, changed []string) error {
+	needed := false
+	for _, p := range changed {
+		if !isCompiledIn(cfg, p) {
+			needed = true
+		}
 	}
-	projects, err := parser.ReadProjects(filepath.Join(cfg.ContentDir, "projects"))
-	if err != nil {
-		return fmt.Errorf("reading projects: %w", err)
+	if !needed {
+		return ErrRestartRequired
+	}
+	parser.Forget(changed...)
+	return Build(cfg)
+}
+
+// isCompiledIn reports whether path is part of the binary: a Go source file,
+// or something under internal/ that is embedded and not read live from
+// cfg.LiveDir.
+func isCompiledIn(cfg Config, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if strings.HasSuffix(path, ".go") {
+		return true
+	}
+	if cfg.LiveDir != "" && strings.HasPrefix(path, filepath.ToSlash(filepath.Clean(cfg.LiveDir))+"/") {
+		return false
 	}
+	return path == "internal" || strings.HasPrefix(path, "internal/")
+}
 
-	// Sort posts newest-first
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].DateParsed.After(posts[j].DateParsed)
-	})
+// newer reports whether a was published after b. Posts on the same day
+// without a time of day are ordered by file name, so "pt2" comes after
+// "pt1" rather than in whatever order the file system listed them.
+func newer(a, b model.Post) bool {
+	if !a.DateParsed.Equal(b.DateParsed) {
+		return a.DateParsed.After(b.DateParsed)
+	}
+	return a.Source > b.Source
+}
 
-	// Group posts into series
+// linkSeries groups posts into series, ordered oldest-first, and links
+// each part to its neighbours.
+func linkSeries(posts []model.Post) {
 	seriesMap := make(map[string]*model.Series)
 	for i := range posts {
 		if posts[i].SeriesTag != "" {
@@ -47,10 +105,9 @@ func Build(cfg Config) error {
 		}
 	}
 
-	// Sort series posts oldest-first (chronological order) and link them
 	for _, s := range seriesMap {
 		sort.Slice(s.Posts, func(i, j int) bool {
-			return s.Posts[i].DateParsed.Before(s.Posts[j].DateParsed)
+			return newer(*s.Posts[j], *s.Posts[i])
 		})
 		for i, p := range s.Posts {
 			p.SeriesPart = i + 1
@@ -62,19 +119,156 @@ func Build(cfg Config) error {
 			}
 		}
 	}
+}
+
+// renderAliases writes a redirect page at every alias of a post or page.
+func renderAliases(r *renderer.Renderer, byLang map[string][]model.Post, pages []model.Page) error {
+	for _, posts := range byLang {
+		for _, p := range posts {
+			for _, a := range p.Aliases {
+				if err := r.RenderAlias(a, p.URLPath(), p.Source); err != nil {
+					return fmt.Errorf("rendering alias %s of post %s: %w", a, p.Slug, err)
+				}
+			}
+		}
+	}
+	for _, p := range pages {
+		for _, a := range p.Aliases {
+			if err := r.RenderAlias(a, p.URLPath(), p.Source); err != nil {
+				return fmt.Errorf("rendering alias %s of page %s: %w", a, p.Slug, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SetupParser configures the content parser from cfg: time zone, diagram
+// commands, HTML policy, shortcodes and UI strings. Build does this itself;
+// commands that read content without building must call it first.
+func SetupParser(cfg Config) error {
+	_, _, err := setupParser(cfg)
+	return err
+}
+
+// setupParser implements SetupParser and returns the UI strings and site
+// languages, the first being the default.
+func setupParser(cfg Config) (i18n.Catalog, []renderer.Language, error) {
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("site time zone: %w", err)
+	}
+	parser.SetLocation(loc)
+	parser.SetDiagrams(cfg.Diagrams, cfg.DiagramDir)
+	if err := parser.SetHTMLPolicy(cfg.HTML); err != nil {
+		return nil, nil, fmt.Errorf("HTML policy: %w", err)
+	}
+	if err := parser.SetShortcodes(cfg.Shortcodes); err != nil {
+		return nil, nil, fmt.Errorf("reading shortcodes: %w", err)
+	}
+	strs, err := i18n.Load(cfg.I18nDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading UI strings: %w", err)
+	}
+	langs := cfg.Languages
+	if len(langs) == 0 {
+		langs = []renderer.Language{{Code: "en", Name: "English"}}
+	}
+	codes := make([]string, len(langs))
+	for i, l := range langs {
+		codes[i] = l.Code
+	}
+	parser.SetLanguages(codes)
+	parser.SetStrings(strs, langs[0].Code)
+	return strs, langs, nil
+}
+
+// Build parses all content, sorts it, and renders the full site.
+func Build(cfg Config) error {
+	strs, langs, err := setupParser(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Parse content
+	posts, err := parser.ReadPosts(filepath.Join(cfg.ContentDir, "posts"))
+	if err != nil {
+		return fmt.Errorf("reading posts: %w", err)
+	}
+	pages, err := parser.ReadPages(filepath.Join(cfg.ContentDir, "pages"))
+	if err != nil {
+		return fmt.Errorf("reading pages: %w", err)
+	}
+	projects, err := parser.ReadProjects(filepath.Join(cfg.ContentDir, "projects"))
+	if err != nil {
+		return fmt.Errorf("reading projects: %w", err)
+	}
+
+	// Drop drafts unless explicitly requested
+	if !cfg.Drafts {
+		published := posts[:0]
+		for _, p := range posts {
+			if !p.Draft {
+				published = append(published, p)
+			}
+		}
+		posts = published
+		publishedPages := pages[:0]
+		for _, p := range pages {
+			if !p.Draft {
+				publishedPages = append(publishedPages, p)
+			}
+		}
+		pages = publishedPages
+	}
+
+	// Sort posts newest-first
+	sort.Slice(posts, func(i, j int) bool {
+		return newer(posts[i], posts[j])
+	})
 
-	// Prepare output directory
+	// Assign languages and split posts per language; each language gets its
+	// own blog list, series, related posts and prev/next chain.
+	if err := assignLanguages(langs, posts, pages); err != nil {
+		return err
+	}
+	git := readGit(cfg.ContentDir)
+	setLastmod(posts, git)
+	setSourceLinks(posts, git, cfg.Repo, cfg.Branch, cfg.History)
+	formatDates(posts, strs, langs[0].Code)
+	byLang := make(map[string][]model.Post, len(langs))
+	for _, p := range posts {
+		byLang[p.Lang] = append(byLang[p.Lang], p)
+	}
+	for _, l := range langs {
+		lp := byLang[l.Code]
+		linkSeries(lp)
+		if err := linkRelated(lp, cfg.Related); err != nil {
+			return err
+		}
+	}
+	linkTranslations(byLang, pages)
+
+	// Render into a staging directory next to the output so a failed or
+	// in-progress build never leaves half-written pages in OutputDir.
 	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
 		return fmt.Errorf("creating output dir: %w", err)
 	}
-
-	// Remove previously generated blog pages to avoid stale URLs
-	// when post slugs/paths change between builds.
-	if err := os.RemoveAll(filepath.Join(cfg.OutputDir, "blog")); err != nil {
-		return fmt.Errorf("cleaning blog output dir: %w", err)
+	staging, err := os.MkdirTemp(filepath.Dir(filepath.Clean(cfg.OutputDir)), "."+filepath.Base(cfg.OutputDir)+"-staging-*")
+	if err != nil {
+		return fmt.Errorf("creating staging dir: %w", err)
 	}
+	defer os.RemoveAll(staging)
 
-	r, err := renderer.New(cfg.OutputDir)
+	r, err := renderer.New(staging, renderer.Options{
+		BaseURL:   cfg.BaseURL,
+		SourceDir: cfg.LiveDir,
+		AssetDirs: cfg.AssetDirs,
+		Minify:    cfg.Minify,
+		Vendor:    cfg.Vendor,
+		VendorDir: cfg.VendorDir,
+		Languages: langs,
+		Strings:   strs,
+	})
 	if err != nil {
 		return fmt.Errorf("initialising renderer: %w", err)
 	}
@@ -83,19 +277,33 @@ func Build(cfg Config) error {
 	if err := r.CopyStaticFiles(); err != nil {
 		return fmt.Errorf("copying static files: %w", err)
 	}
+	if err := r.CopyVendorFiles(); err != nil {
+		return fmt.Errorf("copying vendor files: %w", err)
+	}
 
 	// Render pages
-	if err := r.RenderHome(posts, projects); err != nil {
+	if err := r.RenderHome(byLang[langs[0].Code], projects); err != nil {
 		return fmt.Errorf("rendering home: %w", err)
 	}
-	if err := r.RenderBlogList(posts); err != nil {
-		return fmt.Errorf("rendering blog list: %w", err)
+	for _, l := range langs {
+		lp := byLang[l.Code]
+		if err := r.RenderBlogList(l.Code, lp); err != nil {
+			return fmt.Errorf("rendering %s blog list: %w", l.Code, err)
+		}
+		for i := range lp {
+			if err := r.RenderPost(lp, i); err != nil {
+				return fmt.Errorf("rendering post %s: %w", lp[i].Source, err)
+			}
+		}
 	}
-	for i := range posts {
-		if err := r.RenderPost(posts, i); err != nil {
-			return fmt.Errorf("rendering post %s: %w", posts[i].Slug, err)
+	for _, p := range pages {
+		if err := r.RenderPage(p); err != nil {
+			return fmt.Errorf("rendering page %s: %w", p.Slug, err)
 		}
 	}
+	if err := renderAliases(r, byLang, pages); err != nil {
+		return err
+	}
 	if err := r.RenderWorks(projects); err != nil {
 		return fmt.Errorf("rendering works: %w", err)
 	}
@@ -111,13 +319,42 @@ func Build(cfg Config) error {
 	if err := r.GenerateSearchJSON(posts); err != nil {
 		return fmt.Errorf("generating search.json: %w", err)
 	}
-	if err := r.GenerateRSS(posts); err != nil {
-		return fmt.Errorf("generating RSS: %w", err)
+	for _, l := range langs {
+		var lpages []model.Page
+		for _, p := range pages {
+			if p.Lang == l.Code {
+				lpages = append(lpages, p)
+			}
+		}
+		if err := r.GenerateRSS(l.Code, byLang[l.Code]); err != nil {
+			return fmt.Errorf("generating %s RSS: %w", l.Code, err)
+		}
+		if err := r.GenerateAtom(l.Code, byLang[l.Code]); err != nil {
+			return fmt.Errorf("generating %s Atom feed: %w", l.Code, err)
+		}
+		if err := r.GenerateSitemap(l.Code, byLang[l.Code], lpages, projects); err != nil {
+			return fmt.Errorf("generating %s sitemap: %w", l.Code, err)
+		}
 	}
-	if err := r.GenerateSitemap(posts, projects); err != nil {
-		return fmt.Errorf("generating sitemap: %w", err)
+
+	if cfg.Gzip {
+		n, err := precompress(staging, cfg.GzipMin)
+		if err != nil {
+			return fmt.Errorf("precompressing output: %w", err)
+		}
+		fmt.Printf("Precompressed %d file(s)\n", n)
 	}
 
-	fmt.Printf("Built %d post(s), %d project(s) → %s/\n", len(posts), len(projects), cfg.OutputDir)
+	if err := commitStaged(staging, cfg.OutputDir); err != nil {
+		return fmt.Errorf("publishing output: %w", err)
+	}
+
+	fmt.Printf("Built %d post(s), %d page(s), %d project(s) → %s/\n", len(posts), len(pages), len(projects), cfg.OutputDir)
+	if st := r.MinifyStats(); st.Files > 0 {
+		saved := st.Before - st.After
+		fmt.Printf("Minified %d file(s): %.1f KB → %.1f KB (saved %.1f KB, %.0f%%)\n",
+			st.Files, float64(st.Before)/1024, float64(st.After)/1024,
+			float64(saved)/1024, 100*float64(saved)/float64(st.Before))
+	}
 	return nil
 }
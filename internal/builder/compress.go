@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressible lists the output file types worth precompressing; images and
+// fonts are already compressed.
+var compressible = map[string]bool{
+	".html": true, ".css": true, ".js": true, ".mjs": true, ".json": true,
+	".xml": true, ".svg": true, ".txt": true,
+}
+
+// precompress writes a .gz sibling next to every compressible file in dir of
+// at least minSize bytes, for servers such as nginx with gzip_static on.
+// Files that gzip does not make smaller get no sibling. It returns the number
+// of files written.
+func precompress(dir string, minSize int64) (int, error) {
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !compressible[strings.ToLower(filepath.Ext(path))] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < minSize {
+			return nil
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(raw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if buf.Len() >= len(raw) {
+			return nil
+		}
+		gz := path + ".gz"
+		if err := os.WriteFile(gz, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		n++
+		// Matching mtimes keep the sibling consistent with its source for
+		// conditional requests served by gzip_static.
+		return os.Chtimes(gz, info.ModTime(), info.ModTime())
+	})
+	return n, err
+}
@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"fmt"
+
+	"portfolio/internal/i18n"
+	"portfolio/internal/model"
+	"portfolio/internal/renderer"
+)
+
+// assignLanguages gives posts and pages without a language suffix the
+// default language, sets every URL prefix and rejects unknown languages.
+func assignLanguages(langs []renderer.Language, posts []model.Post, pages []model.Page) error {
+	known := make(map[string]bool, len(langs))
+	for _, l := range langs {
+		known[l.Code] = true
+	}
+	prefix := func(lang, source string) (string, string, error) {
+		if lang == "" {
+			lang = langs[0].Code
+		}
+		if !known[lang] {
+			return "", "", fmt.Errorf("%s: unknown language %q", source, lang)
+		}
+		if lang == langs[0].Code {
+			return lang, "", nil
+		}
+		return lang, "/" + lang, nil
+	}
+	var err error
+	for i := range posts {
+		if posts[i].Lang, posts[i].LangPrefix, err = prefix(posts[i].Lang, posts[i].Source); err != nil {
+			return err
+		}
+	}
+	for i := range pages {
+		if pages[i].Lang, pages[i].LangPrefix, err = prefix(pages[i].Lang, pages[i].Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkTranslations points every post and page at its versions in the
+// other languages: files sharing a name apart from the language suffix,
+// such as foo.md and foo.vi.md.
+func linkTranslations(byLang map[string][]model.Post, pages []model.Page) {
+	posts := map[string][]*model.Post{}
+	for lang := range byLang {
+		for i := range byLang[lang] {
+			p := &byLang[lang][i]
+			posts[p.TranslationKey] = append(posts[p.TranslationKey], p)
+		}
+	}
+	for _, group := range posts {
+		for _, p := range group {
+			for _, t := range group {
+				if t != p {
+					p.Translations = append(p.Translations, t)
+				}
+			}
+		}
+	}
+
+	byKey := map[string][]*model.Page{}
+	for i := range pages {
+		byKey[pages[i].TranslationKey] = append(byKey[pages[i].TranslationKey], &pages[i])
+	}
+	for _, group := range byKey {
+		for _, p := range group {
+			for _, t := range group {
+				if t != p {
+					p.Translations = append(p.Translations, t)
+				}
+			}
+		}
+	}
+}
+
+// formatDates sets each post's display and last-modified dates in the
+// "date.format" layout of its language (a Go time layout such as
+// "Jan 2, 2006"), falling back to the default language's layout.
+func formatDates(posts []model.Post, strs i18n.Catalog, defaultLang string) {
+	for i := range posts {
+		if posts[i].DateParsed.IsZero() {
+			continue
+		}
+		layout, ok := strs[posts[i].Lang]["date.format"]
+		if !ok {
+			layout, ok = strs[defaultLang]["date.format"]
+		}
+		if !ok {
+			layout = "Jan 2, 2006"
+		}
+		posts[i].Date = posts[i].DateParsed.Format(layout)
+		posts[i].LastmodDate = posts[i].Lastmod.Format(layout)
+		for j := range posts[i].History {
+			posts[i].History[j].Date = posts[i].History[j].DateParsed.Format(layout)
+		}
+	}
+}
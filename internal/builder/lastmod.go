@@ -0,0 +1,153 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"portfolio/internal/model"
+)
+
+// gitInfo is what the repository knows about the content files.
+type gitInfo struct {
+	root    string                    // repository top level, "" outside a repository
+	changes map[string][]model.Change // absolute path → commits, newest first
+	dirty   map[string]bool           // absolute paths with uncommitted changes
+}
+
+// setLastmod sets Post.Lastmod from the last commit that touched each post's
+// source file. Files with uncommitted changes use their modification time;
+// files git knows nothing about (new, or no repository at all) use the
+// frontmatter updated: date, then the modification time.
+func setLastmod(posts []model.Post, git gitInfo) {
+	for i := range posts {
+		p := &posts[i]
+		key, _ := filepath.Abs(p.Source)
+		var t time.Time
+		if c := git.changes[key]; len(c) > 0 && !git.dirty[key] {
+			t = c[0].DateParsed
+		} else if !p.Updated.IsZero() && !git.dirty[key] {
+			t = p.Updated
+		} else if info, err := os.Stat(p.Source); err == nil {
+			t = info.ModTime()
+		}
+		if t.Before(p.DateParsed) {
+			t = p.DateParsed
+		}
+		p.Lastmod = t.In(p.DateParsed.Location())
+	}
+}
+
+// setSourceLinks sets Post.SourceURL and, if history is set, Post.History.
+// repo is the GitHub repository URL and branch the one the site is built
+// from; with no repo the history is listed without links.
+func setSourceLinks(posts []model.Post, git gitInfo, repo, branch string, history bool) {
+	repo = strings.TrimSuffix(repo, "/")
+	for i := range posts {
+		p := &posts[i]
+		key, _ := filepath.Abs(p.Source)
+		rel := filepath.ToSlash(p.Source)
+		if git.root != "" {
+			if r, err := filepath.Rel(git.root, key); err == nil {
+				rel = filepath.ToSlash(r)
+			}
+		}
+		if repo != "" {
+			p.SourceURL = repo + "/blob/" + branch + "/" + (&url.URL{Path: rel}).EscapedPath()
+		}
+		p.History = nil
+		if !history {
+			continue
+		}
+		for _, c := range git.changes[key] {
+			c.DateParsed = c.DateParsed.In(p.DateParsed.Location())
+			if repo != "" {
+				c.URL = repo + "/commit/" + c.Hash
+			}
+			p.History = append(p.History, c)
+		}
+	}
+}
+
+// readGit collects the commit history and uncommitted changes of every file
+// under dir. It returns an empty gitInfo if git is not installed or dir is
+// not in a repository.
+//
+// A shallow clone (the default in CI checkouts) only knows its one commit,
+// so every file would look changed at once; fetch the full history there.
+func readGit(dir string) gitInfo {
+	info := gitInfo{changes: map[string][]model.Change{}, dirty: map[string]bool{}}
+	top, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return info
+	}
+	info.root = strings.TrimSpace(string(top))
+
+	out, err := exec.Command("git", "-C", dir, "log", "--format=%x00%cI%x00%h%x00%s", "--name-only", "--no-renames", "--", ".").Output()
+	if err != nil {
+		return info
+	}
+	var commit model.Change
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			fields := strings.SplitN(line[1:], "\x00", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			commit = model.Change{Hash: fields[1], Subject: fields[2]}
+			commit.DateParsed, _ = time.Parse(time.RFC3339, fields[0])
+		case line != "":
+			path := filepath.Join(info.root, filepath.FromSlash(unquoteGitPath(line)))
+			info.changes[path] = append(info.changes[path], commit) // log is newest first
+		}
+	}
+
+	out, err = exec.Command("git", "-C", dir, "status", "--porcelain", "--no-renames", "--", ".").Output()
+	if err != nil {
+		return info
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 3 {
+			info.dirty[filepath.Join(info.root, filepath.FromSlash(unquoteGitPath(line[3:])))] = true
+		}
+	}
+	return info
+}
+
+// unquoteGitPath undoes git's quoting of paths with unusual characters:
+// "content/posts/\303\241.md" is content/posts/á.md. Plain paths, including
+// ones with spaces, are returned unchanged.
+func unquoteGitPath(p string) string {
+	if len(p) < 2 || p[0] != '"' || p[len(p)-1] != '"' {
+		return p
+	}
+	var b strings.Builder
+	for i := 1; i < len(p)-1; i++ {
+		c := p[i]
+		if c != '\\' || i+1 >= len(p)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = p[i]; {
+		case c >= '0' && c <= '7' && i+2 < len(p)-1:
+			b.WriteByte((c-'0')<<6 | (p[i+1]-'0')<<3 | (p[i+2] - '0'))
+			i += 2
+		case c == 'n':
+			b.WriteByte('\n')
+		case c == 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"portfolio/internal/model"
+)
+
+// RelatedConfig controls how Post.Related is computed. Each score component
+// is in [0, 1] before weighting; set a weight to 0 to ignore that signal.
+type RelatedConfig struct {
+	Count        int     // how many related posts to list, 0 to disable
+	TagWeight    float64 // Jaccard overlap of tags
+	SeriesWeight float64 // 1 if both posts are in the same series
+	TextWeight   float64 // TF-IDF cosine similarity of the post bodies
+}
+
+var (
+	markupRe = regexp.MustCompile(`(?s)<pre\b.*?</pre>|<[^>]+>`)
+	// stopWords are skipped when comparing post bodies; common words would
+	// otherwise make every post look alike.
+	stopWords = map[string]bool{
+		"the": true, "and": true, "for": true, "that": true, "this": true, "with": true,
+		"are": true, "was": true, "you": true, "can": true, "will": true, "from": true,
+		"have": true, "not": true, "but": true, "what": true, "all": true, "how": true,
+		"our": true, "its": true, "into": true, "use": true, "then": true, "them": true,
+		"when": true, "which": true, "there": true, "their": true, "also": true, "more": true,
+	}
+)
+
+// linkRelated fills Post.Related for every post: the pinned posts named in
+// its related: frontmatter first, then the best scoring others.
+func linkRelated(posts []model.Post, cfg RelatedConfig) error {
+	if cfg.Count <= 0 {
+		return nil
+	}
+	vectors := tfidf(posts)
+	for i := range posts {
+		p := &posts[i]
+		seen := map[int]bool{i: true}
+		for _, pin := range p.RelatedPins {
+			j := findPost(posts, pin)
+			if j < 0 {
+				return fmt.Errorf("%s: related: no published post %q", p.Source, pin)
+			}
+			if !seen[j] {
+				seen[j] = true
+				p.Related = append(p.Related, &posts[j])
+			}
+		}
+
+		type candidate struct {
+			idx   int
+			score float64
+		}
+		var candidates []candidate
+		for j := range posts {
+			if seen[j] {
+				continue
+			}
+			score := cfg.TagWeight*jaccard(p.Tags, posts[j].Tags) + cfg.TextWeight*cosine(vectors[i], vectors[j])
+			if p.SeriesTag != "" && p.SeriesTag == posts[j].SeriesTag {
+				score += cfg.SeriesWeight
+			}
+			if score > 0 {
+				candidates = append(candidates, candidate{j, score})
+			}
+		}
+		sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].score > candidates[b].score })
+		for _, c := range candidates {
+			if len(p.Related) >= cfg.Count {
+				break
+			}
+			p.Related = append(p.Related, &posts[c.idx])
+		}
+	}
+	return nil
+}
+
+// findPost returns the index of the post that ref names, as a slug
+// ("learning-go-pt1"), directory and slug ("go/learning-go-pt1") or URL
+// path, or -1 if there is none.
+func findPost(posts []model.Post, ref string) int {
+	ref = strings.Trim(ref, "/")
+	for i, p := range posts {
+		if p.Slug == ref || strings.Trim(p.Path+"/"+p.Slug, "/") == ref || strings.Trim(p.URLPath(), "/") == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+// tfidf returns a unit-length TF-IDF vector of the body words of each post.
+func tfidf(posts []model.Post) []map[string]float64 {
+	counts := make([]map[string]int, len(posts))
+	df := map[string]int{}
+	for i, p := range posts {
+		counts[i] = map[string]int{}
+		for _, w := range words(string(p.Content)) {
+			if counts[i][w] == 0 {
+				df[w]++
+			}
+			counts[i][w]++
+		}
+	}
+	n := float64(len(posts))
+	vectors := make([]map[string]float64, len(posts))
+	for i, c := range counts {
+		v := make(map[string]float64, len(c))
+		var norm float64
+		for w, k := range c {
+			x := float64(k) * math.Log(n/float64(df[w]))
+			if x > 0 {
+				v[w] = x
+				norm += x * x
+			}
+		}
+		for w := range v {
+			v[w] /= math.Sqrt(norm)
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// words returns the lowercased words of an HTML body, without code blocks,
+// markup, numbers, short words and stop words.
+func words(html string) []string {
+	text := markupRe.ReplaceAllString(html, " ")
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if len([]rune(w)) >= 3 && !stopWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for w, x := range a {
+		dot += x * b[w]
+	}
+	return dot
+}
+
+// jaccard is the share of tags the two lists have in common.
+func jaccard(a, b []string) float64 {
+	set := map[string]bool{}
+	for _, t := range a {
+		set[strings.ToLower(t)] = true
+	}
+	shared, union := 0, len(set)
+	for _, t := range b {
+		t = strings.ToLower(t)
+		if set[t] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
@@ -0,0 +1,223 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// commitStaged moves every file of a finished build from staging into out.
+// Each file is replaced with a rename, which is atomic on the same file
+// system, so a reader sees either the old or the new version of a page and
+// never a truncated one. Assets are moved before HTML so new pages never
+// reference fingerprinted files that are not in place yet.
+//
+// Every committed file is recorded in a manifest next to out. Files listed in
+// the previous manifest that this build did not produce (renamed posts, old
+// fingerprinted assets, removed tags) are deleted afterwards; files the
+// builder never wrote, such as CNAME, are left alone.
+func commitStaged(staging, out string) error {
+	var files []string
+	err := filepath.WalkDir(staging, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	staged := make(map[string]bool, len(files))
+	for _, rel := range files {
+		staged[rel] = true
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return !isHTML(files[i]) && isHTML(files[j])
+	})
+
+	prev, err := readManifest(out)
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool, len(prev))
+	for _, rel := range prev {
+		written[rel] = true
+	}
+
+	for _, rel := range files {
+		dst := filepath.Join(out, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+			// A page that used to be a directory of generated files, e.g.
+			// a removed section. Anything else in it is not ours to delete.
+			if err := removeGeneratedDir(out, rel, written); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(filepath.Join(staging, rel), dst); err != nil {
+			return err
+		}
+	}
+
+	for _, rel := range prev {
+		if staged[rel] {
+			continue
+		}
+		if err := removeIfExists(filepath.Join(out, rel)); err != nil {
+			return err
+		}
+		pruneEmptyDirs(filepath.Dir(filepath.Join(out, rel)), out)
+	}
+	return writeManifest(out, files)
+}
+
+// removeGeneratedDir removes the directory rel in out if every file in it was
+// written by the previous build, and fails otherwise.
+func removeGeneratedDir(out, rel string, written map[string]bool) error {
+	dir := filepath.Join(out, rel)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		r, err := filepath.Rel(out, path)
+		if err != nil {
+			return err
+		}
+		if !written[r] {
+			return fmt.Errorf("%s is in the way of generated %s and was not written by a build; move it away", path, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// Clean removes every file recorded in the output directory's manifest,
+// leaving anything the builder did not create (CNAME, hand-placed assets).
+// It returns the number of files removed.
+func Clean(cfg Config) (int, error) {
+	files, err := readManifest(cfg.OutputDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, rel := range files {
+		if err := removeIfExists(filepath.Join(cfg.OutputDir, rel)); err != nil {
+			return 0, err
+		}
+		pruneEmptyDirs(filepath.Dir(filepath.Join(cfg.OutputDir, rel)), cfg.OutputDir)
+	}
+	for _, m := range []string{manifestPath(cfg.OutputDir), filepath.Join(cfg.OutputDir, legacyManifestName)} {
+		if err := removeIfExists(m); err != nil {
+			return 0, err
+		}
+	}
+	os.Remove(cfg.OutputDir) // only succeeds if nothing else is left
+	return len(files), nil
+}
+
+// manifestPath returns the file listing every file the last build wrote to
+// out, as slash-separated paths relative to it. It sits next to out, e.g.
+// .docs.manifest.json, so it is not published with the site.
+func manifestPath(out string) string {
+	out = filepath.Clean(out)
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".manifest.json")
+}
+
+// legacyManifestName is where older versions kept the manifest, inside the
+// output directory. It is still read, and removed once replaced.
+const legacyManifestName = ".build-manifest.json"
+
+// readManifest returns the files recorded by the previous build, or nothing
+// if there was none (first build, or output created by an older version).
+func readManifest(out string) ([]string, error) {
+	path := manifestPath(out)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		path = filepath.Join(out, legacyManifestName)
+		b, err = os.ReadFile(path)
+	}
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if err := json.Unmarshal(b, &files); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	rels := make([]string, 0, len(files))
+	for _, f := range files {
+		rel := filepath.FromSlash(f)
+		// Never follow a manifest entry outside the output directory.
+		if !filepath.IsLocal(rel) {
+			continue
+		}
+		rels = append(rels, rel)
+	}
+	return rels, nil
+}
+
+// writeManifest records files (relative to out) for the next build.
+func writeManifest(out string, files []string) error {
+	list := make([]string, len(files))
+	for i, f := range files {
+		list[i] = filepath.ToSlash(f)
+	}
+	sort.Strings(list)
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := manifestPath(out)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return removeIfExists(filepath.Join(out, legacyManifestName))
+}
+
+// pruneEmptyDirs removes dir and its parents up to (not including) out for
+// as long as they are empty.
+func pruneEmptyDirs(dir, out string) {
+	out = filepath.Clean(out)
+	for dir != out && strings.HasPrefix(dir, out) {
+		// A file may have replaced the directory; never remove that.
+		if info, err := os.Lstat(dir); err != nil || !info.IsDir() || os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func isHTML(path string) bool {
+	return strings.HasSuffix(path, ".html")
+}
+
+// removeIfExists removes path, which is already gone if a file replaced one
+// of its parent directories.
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+// Package checker validates the links in a built site: internal hrefs and
+// srcs, #fragments, and optionally external URLs.
+package checker
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options configures a link check run.
+type Options struct {
+	Dir         string        // built site to crawl, e.g. "docs"
+	BaseURL     string        // the site's own URL; absolute links under it are checked in Dir
+	External    bool          // also check absolute http(s) URLs
+	AllowHosts  []string      // if set, only external URLs on these hosts (or subdomains) are checked
+	CacheFile   string        // where external results are remembered between runs
+	CacheTTL    time.Duration // how long a cached external result stays valid
+	PerHostRate time.Duration // minimum delay between requests to the same host
+	Timeout     time.Duration // per-request timeout for external URLs
+}
+
+// Problem is a broken link found on a page.
+type Problem struct {
+	Page   string // page path relative to Dir, e.g. "blog/index.html"
+	Link   string // href or src as written in the page
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", p.Page, p.Link, p.Reason)
+}
+
+var (
+	// rawBodyRe drops script/style bodies (JS building markup in strings
+	// would otherwise look like links) while keeping the opening tag.
+	rawBodyRe   = regexp.MustCompile(`(?is)(<(?:script|style)\b[^>]*>).*?</(?:script|style)>`)
+	commentRe   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	tagRe       = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9-]*)\b([^>]*)>`)
+	attrRe      = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	linkAttrs   = map[string]bool{"href": true, "src": true}
+	skipSchemes = []string{"mailto:", "tel:", "javascript:", "data:"}
+)
+
+// page is the link-relevant content of one HTML file.
+type page struct {
+	links []string
+	ids   map[string]bool
+}
+
+// Check crawls every HTML file in opts.Dir and returns the broken links,
+// sorted by page.
+func Check(opts Options) ([]Problem, error) {
+	pages := map[string]*page{}
+	err := filepath.WalkDir(opts.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".html") {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(opts.Dir, p)
+		if err != nil {
+			return err
+		}
+		pages[filepath.ToSlash(rel)] = parsePage(string(b))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	external := map[string][]string{} // URL → pages linking to it
+	for name, pg := range pages {
+		for _, link := range pg.links {
+			switch local, isSite := siteRelative(opts.BaseURL, link); {
+			case hasSkippedScheme(link):
+			case isSite:
+				if reason := checkInternal(opts.Dir, pages, name, local); reason != "" {
+					problems = append(problems, Problem{Page: name, Link: link, Reason: reason})
+				}
+			case isExternal(link):
+				if opts.External {
+					u := link
+					if strings.HasPrefix(u, "//") {
+						u = "https:" + u
+					}
+					external[u] = append(external[u], name)
+				}
+			default:
+				if reason := checkInternal(opts.Dir, pages, name, link); reason != "" {
+					problems = append(problems, Problem{Page: name, Link: link, Reason: reason})
+				}
+			}
+		}
+	}
+
+	if opts.External && len(external) > 0 {
+		ext, err := checkExternal(opts, external)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, ext...)
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Page != problems[j].Page {
+			return problems[i].Page < problems[j].Page
+		}
+		return problems[i].Link < problems[j].Link
+	})
+	return problems, nil
+}
+
+// parsePage extracts href/src values and element ids from an HTML document.
+func parsePage(doc string) *page {
+	doc = commentRe.ReplaceAllString(doc, "")
+	doc = rawBodyRe.ReplaceAllString(doc, "$1")
+	pg := &page{ids: map[string]bool{}}
+	for _, tag := range tagRe.FindAllStringSubmatch(doc, -1) {
+		for _, a := range attrRe.FindAllStringSubmatch(tag[2], -1) {
+			name := strings.ToLower(a[1])
+			val := html.UnescapeString(a[2] + a[3] + a[4])
+			switch {
+			case linkAttrs[name]:
+				if val = strings.TrimSpace(val); val != "" {
+					pg.links = append(pg.links, val)
+				}
+			case name == "id", name == "name" && strings.EqualFold(tag[1], "a"):
+				pg.ids[val] = true
+			}
+		}
+	}
+	return pg
+}
+
+// checkInternal resolves link relative to the page it appears on and reports
+// why it is broken, or "" if it resolves to a file (and fragment) in dir.
+func checkInternal(dir string, pages map[string]*page, from, link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "malformed URL"
+	}
+	target := from
+	if u.Path != "" {
+		p := u.Path
+		if !strings.HasPrefix(p, "/") {
+			p = path.Join("/", path.Dir(from), p)
+			if strings.HasSuffix(u.Path, "/") {
+				p += "/"
+			}
+		}
+		var ok bool
+		if target, ok = resolve(dir, p); !ok {
+			return "not found"
+		}
+	}
+	if u.Fragment == "" || u.Fragment == "top" {
+		return ""
+	}
+	pg, ok := pages[target]
+	if !ok {
+		return "" // fragment into a non-HTML file, e.g. an SVG sprite
+	}
+	if !pg.ids[u.Fragment] {
+		return "missing anchor #" + u.Fragment
+	}
+	return ""
+}
+
+// resolve maps a URL path to a file in dir the way GitHub Pages does:
+// "/a/" serves a/index.html, "/a" serves a, a.html or a/index.html.
+func resolve(dir, urlPath string) (string, bool) {
+	clean := strings.TrimPrefix(path.Clean(urlPath), "/")
+	var candidates []string
+	if strings.HasSuffix(urlPath, "/") || clean == "" || clean == "." {
+		candidates = []string{path.Join(clean, "index.html")}
+	} else {
+		candidates = []string{clean, clean + ".html", path.Join(clean, "index.html")}
+	}
+	for _, c := range candidates {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(c))); err == nil && !info.IsDir() {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// siteRelative turns an absolute link to the site itself, such as the
+// og:url of a page or the target of an alias redirect, into a path in the
+// built site: with base "https://example.com/blog", the link
+// "https://example.com/blog/a/#x" is "/a/#x".
+func siteRelative(base, link string) (string, bool) {
+	if base == "" || !isExternal(link) {
+		return "", false
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil || !strings.EqualFold(u.Host, b.Host) {
+		return "", false
+	}
+	prefix := strings.TrimSuffix(b.Path, "/")
+	if u.Path != prefix && !strings.HasPrefix(u.Path, prefix+"/") {
+		return "", false
+	}
+	u.Scheme, u.User, u.Host, u.RawPath = "", nil, "", ""
+	if u.Path = strings.TrimPrefix(u.Path, prefix); u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
+
+func isExternal(link string) bool {
+	l := strings.ToLower(link)
+	return strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://") || strings.HasPrefix(l, "//")
+}
+
+func hasSkippedScheme(link string) bool {
+	l := strings.ToLower(link)
+	for _, s := range skipSchemes {
+		if strings.HasPrefix(l, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHosts is how many hosts are checked concurrently; requests to a single
+// host are always sequential and spaced by Options.PerHostRate.
+const maxHosts = 4
+
+// cacheEntry is a remembered external check result.
+type cacheEntry struct {
+	Status    int       `json:"status"`          // HTTP status, 0 on network error
+	Error     string    `json:"error,omitempty"` // network error text
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+func (e cacheEntry) ok() bool {
+	return e.Error == "" && e.Status < 400
+}
+
+// definitive reports whether the result says something about the link rather
+// than the network or a busy server: network errors, 429 and 5xx are checked
+// again on the next run instead of being trusted for the cache TTL.
+func (e cacheEntry) definitive() bool {
+	return e.Error == "" && e.Status != http.StatusTooManyRequests && e.Status < 500
+}
+
+// checkExternal checks every URL in links (URL → linking pages) that passes
+// the host allow-list, reusing fresh cached results.
+func checkExternal(opts Options, links map[string][]string) ([]Problem, error) {
+	cache := map[string]cacheEntry{}
+	if opts.CacheFile != "" {
+		if b, err := os.ReadFile(opts.CacheFile); err == nil {
+			if err := json.Unmarshal(b, &cache); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", opts.CacheFile, err)
+			}
+		}
+	}
+
+	// Group stale or uncached URLs by host so each host can be rate limited.
+	byHost := map[string][]string{}
+	for u := range links {
+		parsed, err := url.Parse(u)
+		if err != nil || !allowed(parsed.Hostname(), opts.AllowHosts) {
+			continue
+		}
+		if e, ok := cache[u]; ok && e.definitive() && time.Since(e.CheckedAt) < opts.CacheTTL {
+			continue
+		}
+		byHost[parsed.Hostname()] = append(byHost[parsed.Hostname()], u)
+	}
+
+	client := &http.Client{Timeout: opts.Timeout}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxHosts)
+	for _, urls := range byHost {
+		sort.Strings(urls)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(urls []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			for i, u := range urls {
+				if i > 0 {
+					time.Sleep(opts.PerHostRate)
+				}
+				e := fetchStatus(client, u)
+				mu.Lock()
+				cache[u] = e
+				mu.Unlock()
+			}
+		}(urls)
+	}
+	wg.Wait()
+
+	if opts.CacheFile != "" {
+		b, err := json.MarshalIndent(cache, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(opts.CacheFile, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []Problem
+	for u, pages := range links {
+		e, ok := cache[u]
+		if !ok || e.ok() {
+			continue // skipped by the allow-list, or fine
+		}
+		reason := e.Error
+		if reason == "" {
+			reason = fmt.Sprintf("HTTP %d", e.Status)
+		}
+		for _, p := range pages {
+			problems = append(problems, Problem{Page: p, Link: u, Reason: reason})
+		}
+	}
+	return problems, nil
+}
+
+// fetchStatus asks for u with HEAD, falling back to GET for servers that
+// do not support HEAD.
+func fetchStatus(client *http.Client, u string) cacheEntry {
+	e := cacheEntry{CheckedAt: time.Now().UTC()}
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			e.Error = err.Error()
+			return e
+		}
+		req.Header.Set("User-Agent", "portfolio-linkcheck/1.0")
+		resp, err := client.Do(req)
+		if err != nil {
+			e.Error = err.Error()
+			return e
+		}
+		resp.Body.Close()
+		e.Status = resp.StatusCode
+		if method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusForbidden) {
+			continue
+		}
+		break
+	}
+	return e
+}
+
+// allowed reports whether host is in the allow-list (an empty list allows
+// every host). Entries match the host itself and its subdomains.
+func allowed(host string, allow []string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, a := range allow {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if host == a || strings.HasSuffix(host, "."+a) {
+			return true
+		}
+	}
+	return false
+}
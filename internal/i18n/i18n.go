@@ -0,0 +1,83 @@
+// Package i18n loads the translatable UI strings of the site templates.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Catalog maps a language code to its UI strings by key.
+type Catalog map[string]map[string]string
+
+// Load reads every <lang>.yaml file in dir, e.g. i18n/en.yaml and
+// i18n/vi.yaml. A missing directory yields an empty catalog.
+func Load(dir string) (Catalog, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	cat := Catalog{}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		strs, err := parse(f, string(b))
+		if err != nil {
+			return nil, err
+		}
+		cat[strings.TrimSuffix(filepath.Base(f), ".yaml")] = strs
+	}
+	return cat, nil
+}
+
+// parse reads a flat YAML mapping of string keys to string values: one
+// "key: value" per line, # comments, and single- or double-quoted values
+// for text that would otherwise be ambiguous. Nesting, lists and multi-line
+// values are not supported; use dotted keys ("nav.blog") instead.
+func parse(name, src string) (map[string]string, error) {
+	strs := map[string]string{}
+	for i, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(trimmed, ":")
+		if !ok || strings.TrimSpace(key) == "" || line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\"", name, i+1)
+		}
+		val, err := unquote(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, i+1, err)
+		}
+		strs[strings.TrimSpace(key)] = val
+	}
+	return strs, nil
+}
+
+// unquote returns a scalar's text: double-quoted values use Go/YAML
+// escapes, single-quoted ones double a quote to escape it, and plain values
+// end at a " #" comment.
+func unquote(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return strings.ReplaceAll(v[1:end], "''", "'"), nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
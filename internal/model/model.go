@@ -8,29 +8,58 @@ import (
 
 // Post represents a blog post parsed from a markdown file.
 type Post struct {
-	Title       string
-	Slug        string
-	Path        string
-	Date        string
-	DateParsed  time.Time
-	Description string
-	Tags        []string      // topic tags e.g. ["Go", "AWS"]
-	SeriesTag   string        // tag identifying the series
-	SeriesTitle string        // title of this part in the series
-	Series      *Series       // back-reference to the full series object
-	SeriesPart  int           // 1-based index in the series
-	SeriesNext  *Post         // next part in the series
-	SeriesPrev  *Post         // previous part in the series
-	ReadTime    int           // estimated minutes to read
-	Content     template.HTML // raw HTML, not escaped in templates
+	Title          string
+	Slug           string
+	Path           string
+	Source         string   // markdown file the post was read from
+	Lang           string   // language code, e.g. "vi" for foo.vi.md
+	LangPrefix     string   // URL prefix of the language, "" for the default one
+	TranslationKey string   // shared by all language versions of a post
+	Translations   []*Post  // the same post in other languages
+	URL            string   // frontmatter url:, replaces the /blog/<path>/<slug>/ default
+	Aliases        []string // old URL paths that redirect here
+	Date           string
+	DateParsed     time.Time
+	Updated        time.Time // frontmatter updated:, used when git has no history
+	Lastmod        time.Time // last content change, never before DateParsed
+	LastmodDate    string    // Lastmod in the display format of the post's language
+	SourceURL      string    // the source file on GitHub, "" without a configured repository
+	History        []Change  // commits that touched the source file, newest first
+	Description    string
+	Tags           []string      // topic tags e.g. ["Go", "AWS"]
+	SeriesTag      string        // tag identifying the series
+	SeriesTitle    string        // title of this part in the series
+	Series         *Series       // back-reference to the full series object
+	SeriesPart     int           // 1-based index in the series
+	SeriesNext     *Post         // next part in the series
+	SeriesPrev     *Post         // previous part in the series
+	Related        []*Post       // most similar other posts, pinned ones first
+	RelatedPins    []string      // frontmatter related: slugs or URL paths to recommend
+	ReadTime       int           // estimated minutes to read
+	Draft          bool          // only built with --drafts
+	Content        template.HTML // raw HTML, not escaped in templates
+	Math           bool          // Content has TeX math for KaTeX to render
+	Mermaid        bool          // Content has Mermaid diagrams to draw
 }
 
 // URLPath returns the canonical blog URL path for this post.
 func (p Post) URLPath() string {
+	if p.URL != "" {
+		return p.URL
+	}
 	if p.Path == "" {
-		return "/blog/" + p.Slug + "/"
+		return p.LangPrefix + "/blog/" + p.Slug + "/"
 	}
-	return "/blog/" + strings.Trim(p.Path, "/") + "/" + p.Slug + "/"
+	return p.LangPrefix + "/blog/" + strings.Trim(p.Path, "/") + "/" + p.Slug + "/"
+}
+
+// Change is a commit in a post's edit history.
+type Change struct {
+	Hash       string // abbreviated commit hash
+	Date       string // display date in the post's language
+	DateParsed time.Time
+	Subject    string
+	URL        string // the commit on GitHub, "" without a configured repository
 }
 
 // Series represents a collection of related blog posts.
@@ -39,6 +68,32 @@ type Series struct {
 	Posts []*Post
 }
 
+// Page is a standalone page such as /uses/, parsed from content/pages.
+type Page struct {
+	Title          string
+	Slug           string
+	Source         string   // markdown file the page was read from
+	Lang           string   // language code, e.g. "vi" for foo.vi.md
+	LangPrefix     string   // URL prefix of the language, "" for the default one
+	TranslationKey string   // shared by all language versions of a page
+	Translations   []*Page  // the same page in other languages
+	URL            string   // frontmatter url:, replaces the /<slug>/ default
+	Aliases        []string // old URL paths that redirect here
+	Description    string
+	Draft          bool
+	Content        template.HTML
+	Math           bool // Content has TeX math for KaTeX to render
+	Mermaid        bool // Content has Mermaid diagrams to draw
+}
+
+// URLPath returns the URL path of the page.
+func (p Page) URLPath() string {
+	if p.URL != "" {
+		return p.URL
+	}
+	return p.LangPrefix + "/" + p.Slug + "/"
+}
+
 // Project represents a portfolio project parsed from a markdown file.
 type Project struct {
 	Title       string
@@ -68,6 +123,7 @@ type SearchEntry struct {
 	Title       string   `json:"title"`
 	Slug        string   `json:"slug"`
 	URL         string   `json:"url"`
+	Lang        string   `json:"lang"`
 	Description string   `json:"description"`
 	Date        string   `json:"date"`
 	Tags        []string `json:"tags"`
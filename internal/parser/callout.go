@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"portfolio/internal/i18n"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// calloutExtension turns GitHub-style alert blockquotes into callouts:
+//
+//	> [!WARNING]
+//	> Text of the warning.
+//
+// The type is one of NOTE, TIP, IMPORTANT, WARNING and CAUTION, in any case.
+// Text after the marker replaces the default title, and a "-" or "+" right
+// after it makes the callout collapsible, closed or open:
+//
+//	> [!TIP]- Why not a channel?
+//
+// A blockquote whose marker names another type stays a blockquote.
+var calloutExtension = &calloutExt{}
+
+var calloutRe = regexp.MustCompile(`(?i)^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\]([+-]?)[ \t]*(.*?)\s*$`)
+
+// calloutIcons are the inline SVG paths of each callout type's icon.
+var calloutIcons = map[string]string{
+	"note":      `<circle cx="12" cy="12" r="10"/><path d="M12 16v-4M12 8h.01"/>`,
+	"tip":       `<path d="M9 18h6M10 22h4M12 2a7 7 0 0 0-4 12.74V17h8v-2.26A7 7 0 0 0 12 2z"/>`,
+	"important": `<path d="M21 15a2 2 0 0 1-2 2H7l-4 4V5a2 2 0 0 1 2-2h14a2 2 0 0 1 2 2z"/><path d="M12 7v4M12 14h.01"/>`,
+	"warning":   `<path d="M10.29 3.86 1.82 18a2 2 0 0 0 1.71 3h16.94a2 2 0 0 0 1.71-3L13.71 3.86a2 2 0 0 0-3.42 0z"/><path d="M12 9v4M12 17h.01"/>`,
+	"caution":   `<path d="M7.86 2h8.28L22 7.86v8.28L16.14 22H7.86L2 16.14V7.86z"/><path d="M12 8v4M12 16h.01"/>`,
+}
+
+var (
+	// langKey holds the language code of the document being converted, ""
+	// for the default language.
+	langKey = parser.NewContextKey()
+
+	stringsMu   sync.Mutex
+	uiStrings   i18n.Catalog
+	defaultLang string
+)
+
+// SetStrings gives the parser the site's UI strings, for text it adds to
+// posts such as callout titles ("callout.note"). Cached posts are parsed
+// again if they change.
+func SetStrings(strs i18n.Catalog, defLang string) {
+	stringsMu.Lock()
+	changed := fmt.Sprint(strs) != fmt.Sprint(uiStrings) || defLang != defaultLang
+	uiStrings, defaultLang = strs, defLang
+	stringsMu.Unlock()
+	if changed {
+		cacheMu.Lock()
+		cache = map[string]cachedPost{}
+		cacheMu.Unlock()
+	}
+}
+
+// translate returns the UI string key in lang, falling back to the default
+// language and then to def.
+func translate(lang, key, def string) string {
+	stringsMu.Lock()
+	defer stringsMu.Unlock()
+	if lang == "" {
+		lang = defaultLang
+	}
+	if s, ok := uiStrings[lang][key]; ok {
+		return s
+	}
+	if s, ok := uiStrings[defaultLang][key]; ok {
+		return s
+	}
+	return def
+}
+
+var kindCallout = ast.NewNodeKind("Callout")
+
+// calloutNode replaces a blockquote with an alert marker; its children are
+// the blockquote's, without the marker line.
+type calloutNode struct {
+	ast.BaseBlock
+	kind  string // "note", "tip", …
+	title string // plain text
+	fold  string // "" not collapsible, "-" closed, "+" open
+}
+
+func (n *calloutNode) Kind() ast.NodeKind { return kindCallout }
+
+func (n *calloutNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Kind": n.kind, "Title": n.title, "Fold": n.fold}, nil)
+}
+
+type calloutTransformer struct{}
+
+func (calloutTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if q, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, q)
+		}
+		return ast.WalkContinue, nil
+	})
+	lang, _ := pc.Get(langKey).(string)
+
+	for _, q := range quotes {
+		para, ok := q.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		first := para.Lines().At(0)
+		m := calloutRe.FindSubmatch(first.Value(source))
+		if m == nil {
+			continue
+		}
+		kind := strings.ToLower(string(m[1]))
+		node := &calloutNode{kind: kind, title: string(m[3]), fold: string(m[2])}
+		if node.title == "" {
+			node.title = translate(lang, "callout."+kind, strings.ToUpper(kind[:1])+kind[1:])
+		}
+
+		// Drop the inlines of the marker line, up to and including its line
+		// break, and the paragraph itself if that was all of it.
+		for c := para.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			para.RemoveChild(para, c)
+			if t, ok := c.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak()) {
+				break
+			}
+			c = next
+		}
+		if para.ChildCount() == 0 {
+			q.RemoveChild(q, para)
+		} else {
+			lines := para.Lines()
+			lines.SetSliced(1, lines.Len())
+		}
+
+		for c := q.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			node.AppendChild(node, c)
+			c = next
+		}
+		q.Parent().ReplaceChild(q.Parent(), q, node)
+	}
+}
+
+type calloutRenderer struct{}
+
+func (calloutRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindCallout, renderCallout)
+}
+
+func renderCallout(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	c := n.(*calloutNode)
+	tag, titleTag := "div", "p"
+	if c.fold != "" {
+		tag, titleTag = "details", "summary"
+	}
+	if !entering {
+		w.WriteString("</div></" + tag + ">\n")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString("<" + tag + ` class="callout callout-` + c.kind + `"`)
+	if c.fold == "+" {
+		w.WriteString(" open")
+	}
+	if c.fold == "" {
+		w.WriteString(` role="note"`)
+	}
+	w.WriteString(">\n<" + titleTag + ` class="callout-title">`)
+	w.WriteString(`<svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round" aria-hidden="true">`)
+	w.WriteString(calloutIcons[c.kind])
+	w.WriteString("</svg>")
+	w.Write(util.EscapeHTML([]byte(c.title)))
+	w.WriteString("</" + titleTag + ">\n" + `<div class="callout-body">` + "\n")
+	return ast.WalkContinue, nil
+}
+
+type calloutExt struct{}
+
+func (calloutExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(calloutTransformer{}, 600)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(calloutRenderer{}, 500)))
+}
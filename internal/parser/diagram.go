@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// diagramExtension turns fenced code blocks in a diagram language into
+// diagrams. ```mermaid blocks become <pre class="mermaid"> for Mermaid to
+// draw in the browser; languages with a configured command (see SetDiagrams)
+// are drawn at build time and inlined as SVG.
+var diagramExtension = &diagramExt{}
+
+var (
+	// hasMermaidKey is set in the parser context when a document contains a
+	// Mermaid diagram.
+	hasMermaidKey = parser.NewContextKey()
+)
+
+var kindDiagram = ast.NewNodeKind("Diagram")
+
+// diagramNode replaces a fenced code block that was recognised as a diagram.
+type diagramNode struct {
+	ast.BaseBlock
+	lang string
+	src  []byte // diagram source, for Mermaid
+	svg  []byte // rendered SVG, for command diagrams
+}
+
+func (n *diagramNode) Kind() ast.NodeKind { return kindDiagram }
+
+func (n *diagramNode) IsRaw() bool { return true }
+
+func (n *diagramNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Lang": n.lang}, nil)
+}
+
+var (
+	diagramMu       sync.Mutex
+	diagramCommands = map[string][]string{} // fenced code language → command
+	diagramCacheDir string
+)
+
+// diagramTimeout bounds a single diagram command.
+const diagramTimeout = 30 * time.Second
+
+// SetDiagrams configures build-time diagram rendering: each command reads a
+// diagram in its language on stdin and writes SVG to stdout, e.g.
+// "dot": {"dot", "-Tsvg"}. Results are kept in cacheDir, keyed by command
+// and source, so unchanged diagrams are not drawn again; an empty cacheDir
+// disables the cache. Cached posts are parsed again if the commands change.
+func SetDiagrams(commands map[string][]string, cacheDir string) {
+	diagramMu.Lock()
+	changed := fmt.Sprint(commands) != fmt.Sprint(diagramCommands) || cacheDir != diagramCacheDir
+	diagramCommands, diagramCacheDir = commands, cacheDir
+	diagramMu.Unlock()
+	if changed {
+		cacheMu.Lock()
+		cache = map[string]cachedPost{}
+		cacheMu.Unlock()
+	}
+}
+
+type diagramTransformer struct{}
+
+func (diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if b, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			blocks = append(blocks, b)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	diagramMu.Lock()
+	commands, cacheDir := diagramCommands, diagramCacheDir
+	diagramMu.Unlock()
+
+	for _, b := range blocks {
+		lang := string(b.Language(source))
+		var src []byte
+		for i := 0; i < b.Lines().Len(); i++ {
+			seg := b.Lines().At(i)
+			src = append(src, seg.Value(source)...)
+		}
+		node := &diagramNode{lang: lang}
+		switch cmd, ok := commands[lang]; {
+		case ok:
+			svg, err := drawDiagram(cmd, cacheDir, lang, src)
+			if err != nil {
+				warn(pc, lineOf(source, b, pc), "%s diagram: %v; showing its source instead", lang, err)
+				continue
+			}
+			node.svg = svg
+		case lang == "mermaid":
+			node.src = src
+			pc.Set(hasMermaidKey, true)
+		default:
+			continue
+		}
+		b.Parent().ReplaceChild(b.Parent(), b, node)
+	}
+}
+
+// lineOf returns the line of the file on which fenced block n starts.
+func lineOf(source []byte, n ast.Node, pc parser.Context) int {
+	if n.Lines().Len() == 0 {
+		first, _ := pc.Get(firstLineKey).(int)
+		return first
+	}
+	// The fence is the line before the first content line.
+	return lineAt(source, n.Lines().At(0).Start, pc) - 1
+}
+
+// drawDiagram runs cmd on src and returns the SVG it writes, from the cache
+// when the same command has drawn the same source before.
+func drawDiagram(cmd []string, cacheDir, lang string, src []byte) ([]byte, error) {
+	sum := sha256.Sum256([]byte(strings.Join(cmd, "\x00") + "\x00\x00" + string(src)))
+	key := hex.EncodeToString(sum[:])[:16]
+	// Graphviz, d2 and others number their ids the same way in every
+	// diagram ("node1", "clip0"); make them unique on the page.
+	prefix := "d" + key[:8] + "-"
+	cached := ""
+	if cacheDir != "" {
+		cached = filepath.Join(cacheDir, lang+"-"+key+".svg")
+		if b, err := os.ReadFile(cached); err == nil {
+			return prefixSVGIDs(b, prefix), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdin = bytes.NewReader(src)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", cmd[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", cmd[0], err)
+	}
+	// Drop the XML declaration and doctype; the SVG is inlined in HTML.
+	svg := stdout.Bytes()
+	i := bytes.Index(svg, []byte("<svg"))
+	if i < 0 {
+		return nil, fmt.Errorf("%s: output is not SVG", cmd[0])
+	}
+	svg = bytes.TrimSpace(svg[i:])
+
+	if cached != "" {
+		if err := writeFileAtomic(cached, svg); err != nil {
+			return nil, err
+		}
+	}
+	return prefixSVGIDs(svg, prefix), nil
+}
+
+// writeFileAtomic writes b to a temporary file next to path and renames it
+// into place, so an interrupted build never leaves a truncated file.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	svgIDRe  = regexp.MustCompile(`(\sid=")([^"]+)"`)
+	svgRefRe = regexp.MustCompile(`(\s(?:xlink:)?href="#)([^"]+)"|url\(#([^)]+)\)`)
+)
+
+// prefixSVGIDs prefixes every id in svg, and the references to them (href,
+// xlink:href and url(#…)), with prefix.
+func prefixSVGIDs(svg []byte, prefix string) []byte {
+	ids := map[string]bool{}
+	for _, m := range svgIDRe.FindAllSubmatch(svg, -1) {
+		ids[string(m[2])] = true
+	}
+	if len(ids) == 0 {
+		return svg
+	}
+	svg = svgIDRe.ReplaceAll(svg, []byte(`${1}`+prefix+`${2}"`))
+	return svgRefRe.ReplaceAllFunc(svg, func(ref []byte) []byte {
+		m := svgRefRe.FindSubmatch(ref)
+		switch {
+		case m[2] != nil && ids[string(m[2])]:
+			return []byte(string(m[1]) + prefix + string(m[2]) + `"`)
+		case m[3] != nil && ids[string(m[3])]:
+			return []byte("url(#" + prefix + string(m[3]) + ")")
+		}
+		return ref
+	})
+}
+
+type diagramRenderer struct{}
+
+func (diagramRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindDiagram, renderDiagram)
+}
+
+func renderDiagram(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	d := n.(*diagramNode)
+	if d.svg != nil {
+		w.WriteString(`<figure class="diagram diagram-` + string(util.EscapeHTML([]byte(d.lang))) + `">`)
+		w.Write(d.svg)
+		w.WriteString("</figure>\n")
+	} else {
+		w.WriteString(`<pre class="mermaid">`)
+		w.Write(util.EscapeHTML(d.src))
+		w.WriteString("</pre>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type diagramExt struct{}
+
+func (diagramExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(diagramTransformer{}, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(diagramRenderer{}, 500)))
+}
@@ -0,0 +1,332 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// HTMLMode is what happens to raw HTML written in markdown.
+type HTMLMode string
+
+const (
+	HTMLStrip    HTMLMode = "strip"    // drop it
+	HTMLAllow    HTMLMode = "allow"    // pass it through unchanged
+	HTMLSanitize HTMLMode = "sanitize" // keep only the allowed tags and attributes
+)
+
+// HTMLPolicy controls raw HTML in posts and pages. Whatever is dropped is
+// logged with its file and line.
+type HTMLPolicy struct {
+	Mode HTMLMode
+	// Allow lists, for HTMLSanitize, the tags that are kept and the
+	// attributes each may have; attributes under "*" are allowed on every
+	// tag. Other tags are removed but their content kept, except <script>
+	// and <style>, whose content goes too. Event handlers (on*) are never
+	// kept, and URLs must be relative or http, https or mailto.
+	Allow map[string][]string
+}
+
+var (
+	htmlMu     sync.Mutex
+	htmlPolicy = HTMLPolicy{Mode: HTMLStrip}
+)
+
+// SetHTMLPolicy sets how raw HTML in markdown is handled. Cached posts are
+// parsed again if the policy changes.
+func SetHTMLPolicy(p HTMLPolicy) error {
+	if p.Mode == "" {
+		p.Mode = HTMLStrip
+	}
+	switch p.Mode {
+	case HTMLStrip, HTMLAllow, HTMLSanitize:
+	default:
+		return fmt.Errorf("unknown HTML mode %q (want %q, %q or %q)", p.Mode, HTMLStrip, HTMLAllow, HTMLSanitize)
+	}
+	htmlMu.Lock()
+	changed := fmt.Sprint(p) != fmt.Sprint(htmlPolicy)
+	htmlPolicy = p
+	htmlMu.Unlock()
+	if changed {
+		cacheMu.Lock()
+		cache = map[string]cachedPost{}
+		cacheMu.Unlock()
+	}
+	return nil
+}
+
+// htmlExtension applies the HTMLPolicy to the raw HTML blocks and inline
+// tags goldmark finds.
+var htmlExtension = &htmlExt{}
+
+var kindPolicyHTML = ast.NewNodeKind("PolicyHTML")
+
+// policyHTMLNode is raw HTML that has been through the policy.
+type policyHTMLNode struct {
+	ast.BaseInline
+	html []byte
+}
+
+func (n *policyHTMLNode) Kind() ast.NodeKind { return kindPolicyHTML }
+
+func (n *policyHTMLNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"HTML": string(n.html)}, nil)
+}
+
+type htmlTransformer struct{}
+
+func (htmlTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var nodes []ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && (n.Kind() == ast.KindHTMLBlock || n.Kind() == ast.KindRawHTML) {
+			nodes = append(nodes, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(nodes) == 0 {
+		return
+	}
+	htmlMu.Lock()
+	policy := htmlPolicy
+	htmlMu.Unlock()
+
+	removed := map[ast.Node]bool{}
+	for _, n := range nodes {
+		if removed[n] {
+			continue
+		}
+		var raw []byte
+		var start int
+		switch n := n.(type) {
+		case *ast.HTMLBlock:
+			for i := 0; i < n.Lines().Len(); i++ {
+				seg := n.Lines().At(i)
+				raw = append(raw, seg.Value(source)...)
+			}
+			if n.HasClosure() {
+				raw = append(raw, n.ClosureLine.Value(source)...)
+			}
+			start = n.Lines().At(0).Start
+		case *ast.RawHTML:
+			for i := 0; i < n.Segments.Len(); i++ {
+				seg := n.Segments.At(i)
+				raw = append(raw, seg.Value(source)...)
+			}
+			start = n.Segments.At(0).Start
+		}
+		line := lineAt(source, start, pc)
+
+		var out []byte
+		var skip string
+		switch policy.Mode {
+		case HTMLAllow:
+			out = raw
+		case HTMLSanitize:
+			var dropped []string
+			out, dropped, skip = sanitizeHTML(raw, policy.Allow, "")
+			if len(dropped) > 0 {
+				warn(pc, line, "removed %s from raw HTML", strings.Join(dropped, ", "))
+			}
+		default:
+			_, _, skip = sanitizeHTML(raw, nil, "")
+			if !isComment(raw) && !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("</")) { // end tags were warned about at the start tag
+				warn(pc, line, "dropped raw HTML %s (the HTML policy is %q)", summarize(raw), policy.Mode)
+			}
+		}
+		// Inline, the content of a <script> or <style> is the siblings up to
+		// its end tag; drop those too.
+		for next := n.NextSibling(); skip != "" && next != nil; {
+			after := next.NextSibling()
+			if r, ok := next.(*ast.RawHTML); ok {
+				var b []byte
+				for i := 0; i < r.Segments.Len(); i++ {
+					seg := r.Segments.At(i)
+					b = append(b, seg.Value(source)...)
+				}
+				var more []byte
+				more, _, skip = sanitizeHTML(b, policy.Allow, skip)
+				if policy.Mode == HTMLSanitize {
+					out = append(out, more...)
+				}
+			}
+			next.Parent().RemoveChild(next.Parent(), next)
+			removed[next] = true
+			next = after
+		}
+		if len(out) == 0 {
+			n.Parent().RemoveChild(n.Parent(), n)
+			continue
+		}
+		n.Parent().ReplaceChild(n.Parent(), n, &policyHTMLNode{html: out})
+	}
+}
+
+// isComment reports whether raw is only an HTML comment, which dropping
+// loses nothing.
+func isComment(raw []byte) bool {
+	s := bytes.TrimSpace(raw)
+	return bytes.HasPrefix(s, []byte("<!--")) && bytes.HasSuffix(s, []byte("-->"))
+}
+
+// summarize shortens raw HTML for a warning: its first tag, or first line.
+func summarize(raw []byte) string {
+	s := strings.TrimSpace(string(raw))
+	if m := htmlTagRe.FindString(s); m != "" {
+		s = m
+	} else if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return s
+}
+
+var (
+	// htmlTokenRe matches a comment, a start or end tag, or a run of text.
+	htmlTokenRe   = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|[^<]+|<`)
+	htmlTagNameRe = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9-]*)`)
+	htmlAttrRe    = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+	// urlAttrs hold URLs, which must be safe to follow.
+	urlAttrs = map[string]bool{
+		"href": true, "src": true, "cite": true, "poster": true, "action": true, "formaction": true,
+		"data": true, "background": true, "ping": true, "longdesc": true, "xlink:href": true,
+	}
+	safeURLRe = regexp.MustCompile(`(?i)^(?:https?:|mailto:|[^:]*$|[^:]*[/?#])`)
+)
+
+// sanitizeHTML keeps the tags and attributes of raw that allow permits and
+// returns what it removed, e.g. "<script>", "onclick= on <div>". skipUntil
+// names a <script> or <style> whose content is being dropped, "" if none; it
+// is passed in for raw that continues one and returned if raw leaves one open.
+func sanitizeHTML(raw []byte, allow map[string][]string, skipUntil string) ([]byte, []string, string) {
+	var out bytes.Buffer
+	removed := map[string]bool{}
+	for _, tok := range htmlTokenRe.FindAllString(string(raw), -1) {
+		switch {
+		case strings.HasPrefix(tok, "<!--"):
+			// Comments are not content; drop them quietly.
+		case tok == "<":
+			if skipUntil == "" {
+				out.WriteString("&lt;")
+			}
+		case tok[0] != '<':
+			if skipUntil == "" {
+				out.WriteString(tok)
+			}
+		default:
+			name := strings.ToLower(htmlTagNameRe.FindStringSubmatch(tok)[1])
+			end := strings.HasPrefix(tok, "</")
+			if skipUntil != "" {
+				if end && name == skipUntil {
+					skipUntil = ""
+				}
+				continue
+			}
+			attrs, ok := allow[name]
+			if !ok {
+				if !end {
+					removed["<"+name+">"] = true
+				}
+				if !end && (name == "script" || name == "style") && !strings.HasSuffix(tok, "/>") {
+					skipUntil = name
+				}
+				continue
+			}
+			if end {
+				out.WriteString("</" + name + ">")
+				continue
+			}
+			out.WriteString("<" + name)
+			rest := tok[len(name)+1 : len(tok)-1]
+			for _, m := range htmlAttrRe.FindAllStringSubmatch(strings.TrimSuffix(rest, "/"), -1) {
+				attr := strings.ToLower(m[1])
+				val := html.UnescapeString(m[2] + m[3] + m[4])
+				if !allowedAttr(attr, attrs, allow["*"]) || !safeAttrURL(attr, val) {
+					removed[attr+"= on <"+name+">"] = true
+					continue
+				}
+				if m[2] == "" && m[3] == "" && m[4] == "" && !strings.Contains(m[0], "=") {
+					out.WriteString(" " + attr)
+				} else {
+					out.WriteString(" " + attr + `="` + html.EscapeString(val) + `"`)
+				}
+			}
+			out.WriteString(">")
+		}
+	}
+	list := make([]string, 0, len(removed))
+	for r := range removed {
+		list = append(list, r)
+	}
+	sort.Strings(list)
+	return out.Bytes(), list, skipUntil
+}
+
+// safeAttrURL reports whether the value of attr, if it holds URLs, only
+// holds safe ones. srcset is a list of "URL descriptor" candidates.
+func safeAttrURL(attr, val string) bool {
+	switch {
+	case attr == "srcset":
+		for _, c := range strings.Split(val, ",") {
+			if f := strings.Fields(c); len(f) > 0 && !safeURLRe.MatchString(f[0]) {
+				return false
+			}
+		}
+		return true
+	case urlAttrs[attr]:
+		return safeURLRe.MatchString(strings.TrimSpace(val))
+	}
+	return true
+}
+
+// allowedAttr reports whether attr may be kept, given the attributes allowed
+// on its tag and on every tag.
+func allowedAttr(attr string, tagAttrs, globalAttrs []string) bool {
+	if strings.HasPrefix(attr, "on") {
+		return false
+	}
+	for _, a := range tagAttrs {
+		if a == attr {
+			return true
+		}
+	}
+	for _, a := range globalAttrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+type htmlRenderer struct{}
+
+func (htmlRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindPolicyHTML, renderPolicyHTML)
+}
+
+func renderPolicyHTML(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.Write(n.(*policyHTMLNode).html)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type htmlExt struct{}
+
+func (htmlExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(htmlTransformer{}, 800)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(htmlRenderer{}, 500)))
+}
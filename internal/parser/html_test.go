@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setHTMLPolicy sets p for the rest of the test and restores the default
+// afterwards.
+func setHTMLPolicy(t *testing.T, p HTMLPolicy) {
+	t.Helper()
+	if err := SetHTMLPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetHTMLPolicy(HTMLPolicy{}) })
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	allow := map[string][]string{
+		"*":       {"class", "title"},
+		"a":       {"href"},
+		"img":     {"src", "srcset", "alt"},
+		"details": {"open"},
+		"summary": nil,
+		"iframe":  {"src"},
+	}
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		removed []string
+	}{
+		// URLs
+		{"https link", `<a href="https://go.dev/">x</a>`, `<a href="https://go.dev/">x</a>`, nil},
+		{"relative link", `<a href="/p?x=javascript:1#top">x</a>`, `<a href="/p?x=javascript:1#top">x</a>`, nil},
+		{"mailto", `<a href="mailto:me@example.com">x</a>`, `<a href="mailto:me@example.com">x</a>`, nil},
+		{"javascript", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript mixed case", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript unquoted", `<a href=javascript:alert(1)>x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript leading space", `<a href="  javascript:alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript entity", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript tab entity", `<a href="java&#x09;script:alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript colon entity", `<a href="javascript&colon;alert(1)">x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"javascript control char", "<a href=\"\x01javascript:alert(1)\">x</a>", `<a>x</a>`, []string{"href= on <a>"}},
+		{"data URL", `<iframe src="data:text/html,x"></iframe>`, `<iframe></iframe>`, []string{"src= on <iframe>"}},
+		{"vbscript", `<a href='vbscript:x'>x</a>`, `<a>x</a>`, []string{"href= on <a>"}},
+		{"srcset", `<img src="a.png" srcset="a2.png 2x, javascript:x 3x">`, `<img src="a.png">`, []string{"srcset= on <img>"}},
+		{"safe srcset", `<img srcset="a.png 1x, https://x.dev/a2.png 2x">`, `<img srcset="a.png 1x, https://x.dev/a2.png 2x">`, nil},
+
+		// Event handlers
+		{"onclick", `<summary onclick="x()">s</summary>`, `<summary>s</summary>`, []string{"onclick= on <summary>"}},
+		{"onerror mixed case", `<img src=x OnError="alert(1)">`, `<img src="x">`, []string{"onerror= on <img>"}},
+		{"handler even if allowed", `<a href="/" onmouseover="x()">x</a>`, `<a href="/">x</a>`, []string{"onmouseover= on <a>"}},
+
+		// Allow-list
+		{"global attribute", `<details open class="c" title="t">x</details>`, `<details open class="c" title="t">x</details>`, nil},
+		{"attribute not allowed", `<a href="/" style="color:red" target="_blank">x</a>`, `<a href="/">x</a>`, []string{"style= on <a>", "target= on <a>"}},
+		{"tag not allowed", `<span class="x">a</span> <b>b</b>`, `a b`, []string{"<b>", "<span>"}},
+		{"void element", `<img src="a.png" alt="a"/>`, `<img src="a.png" alt="a">`, nil},
+		{"upper-case tag", `<DETAILS OPEN>x</DETAILS>`, `<details open>x</details>`, nil},
+		{"values re-escaped", `<a href="/" title='a "b" &lt;c&gt;'>x</a>`, `<a href="/" title="a &#34;b&#34; &lt;c&gt;">x</a>`, nil},
+		{"quote in value", `<a href="/" class="a&quot; onmouseover=&quot;y">x</a>`, `<a href="/" class="a&#34; onmouseover=&#34;y">x</a>`, nil},
+
+		// Script and style
+		{"script", `a<script>alert("<b>")</script>b`, `ab`, []string{"<script>"}},
+		{"style", `<style>p { color: red }</style>x`, `x`, []string{"<style>"}},
+		{"script in svg", `<svg><script>x</script></svg>`, ``, []string{"<script>", "<svg>"}},
+		{"split tag name", `<scr<script>ipt>alert(1)</script>`, `&lt;scr`, []string{"<script>"}},
+		{"comment", `a<!-- <script>x</script> -->b`, `ab`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, removed, skip := sanitizeHTML([]byte(tt.in), allow, "")
+			if string(out) != tt.want {
+				t.Errorf("got  %s\nwant %s", out, tt.want)
+			}
+			if len(removed) == 0 {
+				removed = nil
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed %q, want %q", removed, tt.removed)
+			}
+			if skip != "" {
+				t.Errorf("left %q open", skip)
+			}
+		})
+	}
+}
+
+func TestSanitizeHTMLSkipUntil(t *testing.T) {
+	// Inline, goldmark hands over <script>, its text and </script> as
+	// separate pieces.
+	out, _, skip := sanitizeHTML([]byte(`<script type="x">`), nil, "")
+	if len(out) != 0 || skip != "script" {
+		t.Fatalf("open: got %q, skip %q", out, skip)
+	}
+	out, _, skip = sanitizeHTML([]byte(`alert(1)`), nil, skip)
+	if len(out) != 0 || skip != "script" {
+		t.Fatalf("body: got %q, skip %q", out, skip)
+	}
+	out, _, skip = sanitizeHTML([]byte(`</style></script>`), nil, skip)
+	if len(out) != 0 || skip != "" {
+		t.Fatalf("close: got %q, skip %q", out, skip)
+	}
+	if out, _, _ = sanitizeHTML([]byte(`<script/>after`), nil, ""); string(out) != "after" {
+		t.Fatalf("self-closing: got %q", out)
+	}
+}
+
+func TestHTMLPolicy(t *testing.T) {
+	const src = "Text <b>bold</b> <script>alert(1)</script> and <kbd onclick=\"x()\">K</kbd> <style>p{}</style> end <!-- note -->\n" +
+		"\n" +
+		"<details open>\n" +
+		"<summary>More</summary>\n" +
+		"<script>\n" +
+		"block()\n" +
+		"</script>\n" +
+		"</details>\n"
+	tests := []struct {
+		name  string
+		mode  HTMLMode
+		want  string
+		warns []string
+	}{
+		{
+			name: "strip",
+			mode: HTMLStrip,
+			want: "<p>Text bold  and K  end </p>\n",
+			warns: []string{
+				`post.md:1: dropped raw HTML <b> (the HTML policy is "strip")`,
+				`post.md:1: dropped raw HTML <script> (the HTML policy is "strip")`,
+				`post.md:1: dropped raw HTML <kbd onclick="x()"> (the HTML policy is "strip")`,
+				`post.md:1: dropped raw HTML <style> (the HTML policy is "strip")`,
+				`post.md:3: dropped raw HTML <details open> (the HTML policy is "strip")`,
+			},
+		},
+		{
+			name: "sanitize",
+			mode: HTMLSanitize,
+			want: "<p>Text bold  and <kbd>K</kbd>  end </p>\n" +
+				"<details open>\n<summary>More</summary>\n\n</details>\n",
+			warns: []string{
+				`post.md:1: removed <b> from raw HTML`,
+				`post.md:1: removed <script> from raw HTML`,
+				`post.md:1: removed onclick= on <kbd> from raw HTML`,
+				`post.md:1: removed <style> from raw HTML`,
+				`post.md:3: removed <script> from raw HTML`,
+			},
+		},
+		{
+			name: "allow",
+			mode: HTMLAllow,
+			want: "<p>Text <b>bold</b> <script>alert(1)</script> and <kbd onclick=\"x()\">K</kbd> <style>p{}</style> end <!-- note --></p>\n" +
+				"<details open>\n<summary>More</summary>\n<script>\nblock()\n</script>\n</details>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setHTMLPolicy(t, HTMLPolicy{Mode: tt.mode, Allow: map[string][]string{
+				"details": {"open"}, "summary": nil, "kbd": nil,
+			}})
+			doc, logged := convert(t, src)
+			if doc.html != tt.want {
+				t.Errorf("got  %q\nwant %q", doc.html, tt.want)
+			}
+			var warns []string
+			for _, line := range strings.Split(strings.TrimSpace(logged), "\n") {
+				if _, w, ok := strings.Cut(line, "warning: "); ok {
+					warns = append(warns, w)
+				}
+			}
+			if !reflect.DeepEqual(warns, tt.warns) {
+				t.Errorf("warnings:\n got  %q\n want %q", warns, tt.warns)
+			}
+		})
+	}
+}
+
+func TestSetHTMLPolicy(t *testing.T) {
+	if err := SetHTMLPolicy(HTMLPolicy{Mode: "escape"}); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mathExtension keeps TeX math away from the markdown parser: $…$ inline and
+// $$…$$ display math (inline, or as a block of lines starting and ending with
+// $$) are emitted exactly as written, HTML-escaped, inside
+// <span class="math math-inline"> or <span|div class="math math-display">
+// for KaTeX to render in the browser. A $ followed by a space or a digit does
+// not open math, and the first $ that cannot close it ends the attempt, so
+// "$5 and $10" stays text even with math later in the paragraph; \$ is a
+// literal dollar sign.
+var mathExtension = &mathExt{}
+
+// hasMathKey is set in the parser context when a document contains math.
+var hasMathKey = parser.NewContextKey()
+
+var (
+	kindMath      = ast.NewNodeKind("Math")
+	kindMathBlock = ast.NewNodeKind("MathBlock")
+)
+
+// mathNode is inline math; its segment covers the delimiters.
+type mathNode struct {
+	ast.BaseInline
+	segment text.Segment
+	display bool
+}
+
+func (n *mathNode) Kind() ast.NodeKind { return kindMath }
+
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.segment.Value(source))}, nil)
+}
+
+// mathBlock is display math on lines of its own; its lines include the
+// delimiter lines.
+type mathBlock struct {
+	ast.BaseBlock
+	closed bool // the closing $$ has been read
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	if len(line) <= delim || line[delim] == ' ' || line[delim] == '\t' || line[delim] == '\n' {
+		return nil
+	}
+	if delim == 1 && line[1] >= '0' && line[1] <= '9' {
+		return nil // a price, "$5"
+	}
+	for i := delim + 1; i+delim <= len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++ // skip the escaped character
+		case bytes.HasPrefix(line[i:], []byte("$$"[:delim])):
+			// Not looking past a $ that cannot close keeps "$5 and $10"
+			// from pairing with a later $.
+			if line[i-1] == ' ' || line[i-1] == '\t' {
+				return nil
+			}
+			end := i + delim
+			if delim == 1 && end < len(line) && (line[end] == '$' || line[end] >= '0' && line[end] <= '9') {
+				return nil
+			}
+			block.Advance(end)
+			pc.Set(hasMathKey, true)
+			return &mathNode{segment: segment.WithStop(segment.Start + end), display: delim == 2}
+		}
+	}
+	return nil
+}
+
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	rest := bytes.TrimSpace(line[pos+2:])
+	closed := len(rest) >= 2 && bytes.HasSuffix(rest, []byte("$$")) // $$…$$ on one line
+	if !closed && !mathBlockCloses(reader.Source()[segment.Stop:]) {
+		// A typo must not swallow the rest of the document.
+		warn(pc, lineAt(reader.Source(), segment.Start, pc), "unclosed $$ display math; leaving it as text")
+		return nil, parser.NoChildren
+	}
+	node := &mathBlock{closed: closed}
+	node.Lines().Append(text.NewSegment(segment.Start+pos, segment.Stop))
+	reader.AdvanceToEOL()
+	pc.Set(hasMathKey, true)
+	return node, parser.NoChildren
+}
+
+// mathBlockCloses reports whether a line of src ending in $$ closes a display
+// math block before the next blank line, which TeX display math cannot have.
+func mathBlockCloses(src []byte) bool {
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return false
+		}
+		if bytes.HasSuffix(line, []byte("$$")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*mathBlock).closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.AdvanceToEOL()
+	if bytes.HasSuffix(bytes.TrimSpace(line), []byte("$$")) {
+		return parser.Close
+	}
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, renderMath)
+	reg.Register(kindMathBlock, renderMathBlock)
+}
+
+func renderMath(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		m := n.(*mathNode)
+		class := "math math-inline"
+		if m.display {
+			class = "math math-display"
+		}
+		w.WriteString(`<span class="` + class + `">`)
+		w.Write(util.EscapeHTML(m.segment.Value(source)))
+		w.WriteString("</span>")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func renderMathBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString(`<div class="math math-display">`)
+		lines := n.Lines()
+		var tex []byte
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			tex = append(tex, seg.Value(source)...)
+		}
+		w.Write(util.EscapeHTML(bytes.TrimSpace(tex)))
+		w.WriteString("</div>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type mathExt struct{}
+
+func (mathExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 150)),
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 650)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 500)))
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineMath(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // HTML of the paragraph
+		math bool
+	}{
+		{"inline", `Area $\pi r^2$ here`, `<p>Area <span class="math math-inline">$\pi r^2$</span> here</p>`, true},
+		{"display in paragraph", `so $$a + b$$ holds`, `<p>so <span class="math math-display">$$a + b$$</span> holds</p>`, true},
+		{"currency", `It costs $5 and $10.`, `<p>It costs $5 and $10.</p>`, false},
+		{"currency then math", `Price $5 and $10 here. Inline $x^2$ math`, `<p>Price $5 and $10 here. Inline <span class="math math-inline">$x^2$</span> math</p>`, true},
+		{"space after opener", `a $ b$ c`, `<p>a $ b$ c</p>`, false},
+		{"space before closer", `a $b $c$`, `<p>a $b <span class="math math-inline">$c$</span></p>`, true},
+		{"escaped dollar", `\$x$ and \$y`, `<p>$x$ and $y</p>`, false},
+		{"escape inside math", `$a \$ b$`, `<p><span class="math math-inline">$a \$ b$</span></p>`, true},
+		{"markdown untouched", `$a_1 * b_2 * c$`, `<p><span class="math math-inline">$a_1 * b_2 * c$</span></p>`, true},
+		{"html escaped", `$a<b$`, `<p><span class="math math-inline">$a&lt;b$</span></p>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := convert(t, tt.src)
+			if got := strings.TrimSpace(doc.html); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+			if doc.math != tt.math {
+				t.Errorf("math = %v, want %v", doc.math, tt.math)
+			}
+		})
+	}
+}
+
+func TestMathBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		warn string // substring of the logged warning, "" for none
+	}{
+		{
+			name: "block",
+			src:  "a\n\n$$\nx_1 + x_2\n$$\n\nb\n",
+			want: "<p>a</p>\n<div class=\"math math-display\">$$\nx_1 + x_2\n$$</div>\n<p>b</p>",
+		},
+		{
+			name: "one line",
+			src:  "$$ x^2 $$\n\nb\n",
+			want: "<div class=\"math math-display\">$$ x^2 $$</div>\n<p>b</p>",
+		},
+		{
+			name: "unclosed",
+			src:  "a\n\n$$\nx^2\n\n*after*\n",
+			want: "<p>a</p>\n<p>$$\nx^2</p>\n<p><em>after</em></p>",
+			warn: "post.md:3: unclosed $$ display math",
+		},
+		{
+			name: "unclosed before a later block",
+			src:  "$$\nx\n\ntext\n\n$$\ny\n$$\n",
+			want: "<p>$$\nx</p>\n<p>text</p>\n<div class=\"math math-display\">$$\ny\n$$</div>",
+			warn: "post.md:1: unclosed $$ display math",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, logged := convert(t, tt.src)
+			if got := strings.TrimSpace(doc.html); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+			if tt.warn == "" && logged != "" {
+				t.Errorf("unexpected warning %q", logged)
+			}
+			if !strings.Contains(logged, tt.warn) {
+				t.Errorf("warning %q does not contain %q", logged, tt.warn)
+			}
+		})
+	}
+}
@@ -2,29 +2,171 @@ package parser
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
+	"log"
 	"math"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"portfolio/internal/model"
 
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
 )
 
 var htmlTagRe = regexp.MustCompile(`<[^>]+>`)
 
-// markdownToHTML converts markdown content to HTML using goldmark.
-func markdownToHTML(markdown string) string {
-	md := goldmark.New()
+// cachedPost is a parsed post remembered between builds in the same process
+// (the dev server), valid while its source file is unchanged.
+type cachedPost struct {
+	modTime time.Time
+	size    int64
+	post    model.Post
+}
+
+var (
+	cacheMu   sync.Mutex
+	cache     = map[string]cachedPost{} // source path → parsed post
+	location  = time.UTC                // zone of frontmatter dates without an offset
+	languages = map[string]bool{}       // language codes recognised in file names
+)
+
+// dateLayouts are the accepted frontmatter date formats, tried in order.
+// Layouts without an offset are read in the site time zone.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// SetLocation sets the time zone of frontmatter dates that do not carry an
+// offset, e.g. Asia/Ho_Chi_Minh. Cached posts are parsed again if it changes.
+func SetLocation(loc *time.Location) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if loc.String() != location.String() {
+		location = loc
+		cache = map[string]cachedPost{}
+	}
+}
+
+// SetLanguages sets the site's language codes. Only these are read as the
+// language of a file name such as foo.vi.md; any other suffix, like the "js"
+// of vue.js.md, is part of the slug. Cached posts are parsed again if they
+// change.
+func SetLanguages(codes []string) {
+	known := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		known[c] = true
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if fmt.Sprint(known) != fmt.Sprint(languages) {
+		languages = known
+		cache = map[string]cachedPost{}
+	}
+}
+
+// ParseDate parses a frontmatter date in any of dateLayouts.
+func ParseDate(val string) (time.Time, error) {
+	cacheMu.Lock()
+	loc := location
+	cacheMu.Unlock()
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, val, loc); err == nil {
+			return t.In(loc), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Forget drops the cached parse results for the given source paths so the
+// next ReadPosts parses them again regardless of their modification times.
+func Forget(paths ...string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	for _, p := range paths {
+		delete(cache, filepath.Clean(p))
+	}
+}
+
+// markdown is the goldmark instance every post and page goes through.
+var markdown = goldmark.New(goldmark.WithExtensions(mathExtension, diagramExtension, calloutExtension, shortcodeExtension, htmlExtension))
+
+// document is a markdown body converted to HTML, with what the page needs
+// to display it.
+type document struct {
+	html    string
+	math    bool // contains TeX math, so the page needs KaTeX
+	mermaid bool // contains Mermaid diagrams, so the page needs Mermaid
+}
+
+var (
+	// firstLineKey holds the int line of the file the markdown body starts
+	// on, for error and warning locations.
+	firstLineKey = parser.NewContextKey()
+	// warningsKey holds the []*Error of problems found while converting a
+	// document that did not stop it, such as dropped raw HTML.
+	warningsKey = parser.NewContextKey()
+)
+
+// warn records a warning at line of the document being converted.
+func warn(pc parser.Context, line int, format string, args ...any) {
+	w, _ := pc.Get(warningsKey).([]*Error)
+	pc.Set(warningsKey, append(w, &Error{Line: line, Err: fmt.Errorf(format, args...)}))
+}
+
+// lineAt returns the line of the file at offset pos of the markdown body.
+func lineAt(source []byte, pos int, pc parser.Context) int {
+	first, _ := pc.Get(firstLineKey).(int)
+	return first + bytes.Count(source[:pos], []byte("\n"))
+}
+
+// markdownToHTML converts markdown content to HTML using goldmark. Errors in
+// the content, such as an unknown shortcode, are returned as *Error; problems
+// that do not stop the conversion, such as a diagram that failed to draw or
+// raw HTML the HTML policy dropped, are logged against source. firstLine is
+// the line of source that src starts on, so messages point into the file
+// rather than the body. lang is the language of the text, "" for the default
+// one.
+func markdownToHTML(source string, firstLine int, lang, src string) (document, error) {
 	var buf bytes.Buffer
-	if err := md.Convert([]byte(markdown), &buf); err != nil {
-		return markdown // fallback to original if conversion fails
+	pc := parser.NewContext()
+	pc.Set(firstLineKey, firstLine)
+	pc.Set(langKey, lang)
+	if err := markdown.Convert([]byte(src), &buf, parser.WithContext(pc)); err != nil {
+		// Never fall back to the source: it would bypass the HTML policy.
+		return document{}, &Error{File: source, Err: fmt.Errorf("converting markdown: %w", err)}
+	}
+	if err, ok := pc.Get(shortcodeErrKey).(*Error); ok {
+		err.File = source
+		return document{}, err
+	}
+	if w, ok := pc.Get(warningsKey).([]*Error); ok {
+		for _, e := range w {
+			e.File = source
+			log.Printf("warning: %v", e)
+		}
 	}
-	return buf.String()
+	return document{
+		html:    buf.String(),
+		math:    pc.Get(hasMathKey) != nil,
+		mermaid: pc.Get(hasMermaidKey) != nil,
+	}, nil
 }
 
 // readTime estimates minutes to read based on a ~200 wpm average.
@@ -39,6 +181,8 @@ func readTime(htmlContent string) int {
 }
 
 // ReadPosts reads all .md files from dir and returns a slice of Posts.
+// Files unchanged since a previous call in the same process are not parsed
+// again.
 func ReadPosts(dir string) ([]model.Post, error) {
 	var posts []model.Post
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
@@ -49,6 +193,18 @@ func ReadPosts(dir string) ([]model.Post, error) {
 			return nil
 		}
 
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		cacheMu.Lock()
+		c, ok := cache[filepath.Clean(path)]
+		cacheMu.Unlock()
+		if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+			posts = append(posts, c.post)
+			return nil
+		}
+
 		raw, err := os.ReadFile(path)
 		if err != nil {
 			return err
@@ -58,14 +214,27 @@ func ReadPosts(dir string) ([]model.Post, error) {
 		if err != nil {
 			return err
 		}
-		slug := strings.TrimSuffix(filepath.Base(rel), ".md")
-		relDir := filepath.Dir(rel)
-		if relDir == "." {
-			relDir = ""
+		name, lang := splitLang(strings.TrimSuffix(filepath.Base(rel), ".md"))
+		slug := Slugify(name)
+		var sections []string
+		if relDir := filepath.Dir(rel); relDir != "." {
+			for _, s := range strings.Split(filepath.ToSlash(relDir), "/") {
+				sections = append(sections, Slugify(s))
+			}
 		}
-		relDir = filepath.ToSlash(relDir)
+		relDir := strings.Join(sections, "/")
 
-		posts = append(posts, parsePost(relDir, slug, string(raw)))
+		post, err := parsePost(path, lang, relDir, slug, string(raw))
+		if err != nil {
+			return err
+		}
+		post.Source = path
+		post.Lang = lang
+		post.TranslationKey = strings.Trim(relDir+"/"+slug, "/")
+		cacheMu.Lock()
+		cache[filepath.Clean(path)] = cachedPost{modTime: info.ModTime(), size: info.Size(), post: post}
+		cacheMu.Unlock()
+		posts = append(posts, post)
 		return nil
 	})
 	if err != nil {
@@ -101,17 +270,64 @@ func ReadProjects(dir string) ([]model.Project, error) {
 	return projects, nil
 }
 
+// ReadPages reads all .md files from dir as standalone pages.
+// Returns an empty slice (no error) if the directory does not exist.
+func ReadPages(dir string) ([]model.Page, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []model.Page
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".md") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		// Pages share the post frontmatter format; only a subset applies.
+		name, lang := splitLang(strings.TrimSuffix(f.Name(), ".md"))
+		p, err := parsePost(filepath.Join(dir, f.Name()), lang, "", Slugify(name), string(raw))
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, model.Page{
+			Title:          p.Title,
+			Slug:           p.Slug,
+			Source:         filepath.Join(dir, f.Name()),
+			Lang:           lang,
+			TranslationKey: Slugify(name),
+			URL:            p.URL,
+			Aliases:        p.Aliases,
+			Description:    p.Description,
+			Draft:          p.Draft,
+			Content:        p.Content,
+			Math:           p.Math,
+			Mermaid:        p.Mermaid,
+		})
+	}
+	return pages, nil
+}
+
 // parsePost parses a markdown file with a simple key: value frontmatter block
-// terminated by "---", followed by raw HTML content.
+// terminated by "---", followed by markdown content; raw HTML in it is handled
+// by the HTML policy (see SetHTMLPolicy). source is the file name,
+// used in errors and warnings, and lang the language of the file ("" for the
+// default).
 //
 // Example:
 //
 //	title: My Post
-//	date: 2026-02-28
+//	date: 2026-02-28        (or 2026-02-28T09:30:00+07:00, 2026-02-28 09:30)
 //	description: A short summary
 //	---
-//	<p>HTML content here…</p>
-func parsePost(path, slug, raw string) model.Post {
+//	Markdown content here…
+func parsePost(source, lang, path, slug, raw string) (model.Post, error) {
 	post := model.Post{Slug: slug, Path: path}
 	lines := strings.Split(raw, "\n")
 	bodyStart := len(lines)
@@ -132,13 +348,29 @@ func parsePost(path, slug, raw string) model.Post {
 		switch key {
 		case "title":
 			post.Title = val
+		case "slug":
+			if s := Slugify(val); s != "" {
+				post.Slug = s
+			}
+		case "url":
+			post.URL = cleanURLPath(val)
+		case "aliases":
+			for _, a := range strings.Split(val, ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					post.Aliases = append(post.Aliases, cleanURLPath(a))
+				}
+			}
 		case "date":
-			if t, err := time.Parse("2006-01-02", val); err == nil {
+			if t, err := ParseDate(val); err == nil {
 				post.DateParsed = t
 				post.Date = t.Format("Jan 2, 2006")
 			} else {
 				post.Date = val
 			}
+		case "updated":
+			if t, err := ParseDate(val); err == nil {
+				post.Updated = t
+			}
 		case "description":
 			post.Description = val
 		case "tags":
@@ -147,18 +379,62 @@ func parsePost(path, slug, raw string) model.Post {
 					post.Tags = append(post.Tags, t)
 				}
 			}
+		case "related":
+			for _, r := range strings.Split(val, ",") {
+				if r = strings.TrimSpace(r); r != "" {
+					post.RelatedPins = append(post.RelatedPins, r)
+				}
+			}
 		case "series":
 			post.SeriesTag = val
 		case "series_title":
 			post.SeriesTitle = val
+		case "draft":
+			post.Draft = val == "true"
 		}
 	}
 
 	body := strings.Join(lines[bodyStart:], "\n")
-	htmlContent := markdownToHTML(body)
-	post.Content = template.HTML(htmlContent)
-	post.ReadTime = readTime(htmlContent)
-	return post
+	doc, err := markdownToHTML(source, bodyStart+1, lang, body)
+	if err != nil {
+		return post, err
+	}
+	post.Content = template.HTML(doc.html)
+	post.Math = doc.math
+	post.Mermaid = doc.mermaid
+	post.ReadTime = readTime(doc.html)
+	return post, nil
+}
+
+// langSuffixRe matches the last dotted suffix of a file name such as
+// "foo.vi" (from foo.vi.md), which may be a language code.
+var langSuffixRe = regexp.MustCompile(`^(.+)\.([^.]+)$`)
+
+// splitLang splits "foo.vi" into "foo" and "vi". Names without the suffix of
+// a language set by SetLanguages return an empty language, meaning the
+// site's default.
+func splitLang(name string) (string, string) {
+	cacheMu.Lock()
+	known := languages
+	cacheMu.Unlock()
+	if m := langSuffixRe.FindStringSubmatch(name); m != nil && known[m[2]] {
+		return m[1], m[2]
+	}
+	return name, ""
+}
+
+// cleanURLPath normalises a frontmatter URL path to the directory form
+// used for every page: "/blog/x" and "blog/x/" both become "/blog/x/".
+// Percent-escapes are decoded so aliases can be copied from a browser.
+func cleanURLPath(p string) string {
+	if u, err := url.PathUnescape(p); err == nil {
+		p = u
+	}
+	p = path.Clean("/" + strings.Trim(p, "/"))
+	if p == "/" {
+		return p
+	}
+	return p + "/"
 }
 
 // parseProject parses a project markdown file (no body content, only frontmatter).
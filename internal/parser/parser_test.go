@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+// convert runs src through markdownToHTML and returns the HTML and what was
+// logged as warnings.
+func convert(t *testing.T, src string) (document, string) {
+	t.Helper()
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	doc, err := markdownToHTML("post.md", 1, "", src)
+	if err != nil {
+		t.Fatalf("markdownToHTML(%q): %v", src, err)
+	}
+	return doc, logged.String()
+}
@@ -0,0 +1,335 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Error is a problem at a known place in a source file, such as an unknown
+// shortcode in a post.
+type Error struct {
+	File string
+	Line int // 1-based, 0 if unknown
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Location returns the file and line of the error, for editors and the dev
+// server's error overlay.
+func (e *Error) Location() (string, int) { return e.File, e.Line }
+
+// shortcodeExtension expands shortcodes in markdown:
+//
+//	{{< figure src="/images/arch.svg" caption="Producer and consumer" >}}
+//	{{< youtube dQw4w9WgXcQ >}}
+//
+// Arguments are name="value" pairs or positional values, quoted if they
+// contain spaces. Each shortcode is an html/template, either built in
+// (builtinShortcodes) or layouts/shortcodes/<name>.html (see SetShortcodes).
+// A shortcode alone in a paragraph replaces the paragraph; inside text it is
+// inlined. {{</* name */>}} is written out literally as {{< name >}}, for
+// documenting shortcodes. Shortcodes in code spans and blocks are left alone.
+var shortcodeExtension = &shortcodeExt{}
+
+// builtinShortcodes are the shortcodes available without a layouts/shortcodes
+// file of the same name.
+var builtinShortcodes = map[string]string{
+	"figure": `<figure class="figure{{with .Get "class"}} {{.}}{{end}}">` +
+		`{{with .Get "link"}}<a href="{{.}}">{{end}}` +
+		`<img src="{{.Require "src"}}" alt="{{with .Get "alt"}}{{.}}{{else}}{{.Get "caption"}}{{end}}" loading="lazy"` +
+		`{{with .Get "width"}} width="{{.}}"{{end}}{{with .Get "height"}} height="{{.}}"{{end}}>` +
+		`{{if .Get "link"}}</a>{{end}}` +
+		`{{with .Get "caption"}}<figcaption>{{.}}</figcaption>{{end}}</figure>`,
+	"youtube": `{{$id := or (.Get "id") (.Arg 0)}}` +
+		`<div class="embed embed-youtube">` +
+		`<iframe src="https://www.youtube-nocookie.com/embed/{{if not $id}}{{.Require "id"}}{{end}}{{$id}}{{with .Get "start"}}?start={{.}}{{end}}"` +
+		` title="{{or (.Get "title") "YouTube video"}}" loading="lazy"` +
+		` allow="accelerometer; clipboard-write; encrypted-media; gyroscope; picture-in-picture; web-share" allowfullscreen></iframe></div>`,
+	"gist": `{{$user := or (.Get "user") (.Arg 0)}}{{$id := or (.Get "id") (.Arg 1)}}` +
+		`{{if not $user}}{{.Require "user"}}{{end}}{{if not $id}}{{.Require "id"}}{{end}}` +
+		`<script src="https://gist.github.com/{{$user}}/{{$id}}.js{{with .Get "file"}}?file={{.}}{{end}}"></script>` +
+		`<noscript><a href="https://gist.github.com/{{$user}}/{{$id}}">gist.github.com/{{$user}}/{{$id}}</a></noscript>`,
+	"tweet": `{{$user := or (.Get "user") (.Arg 0)}}{{$id := or (.Get "id") (.Arg 1)}}` +
+		`{{if not $user}}{{.Require "user"}}{{end}}{{if not $id}}{{.Require "id"}}{{end}}` +
+		`<blockquote class="twitter-tweet"><a href="https://twitter.com/{{$user}}/status/{{$id}}">@{{$user}} on X</a></blockquote>` +
+		`<script async src="https://platform.twitter.com/widgets.js" charset="utf-8"></script>`,
+}
+
+// ShortcodeArgs is what a shortcode template is executed with.
+type ShortcodeArgs struct {
+	Name   string
+	Params map[string]string // name="value" arguments
+	Args   []string          // positional arguments, in order
+}
+
+// Get returns the named argument, or "" if it was not given.
+func (a ShortcodeArgs) Get(name string) string { return a.Params[name] }
+
+// Arg returns the i'th positional argument, or "" if there are fewer.
+func (a ShortcodeArgs) Arg(i int) string {
+	if i < 0 || i >= len(a.Args) {
+		return ""
+	}
+	return a.Args[i]
+}
+
+// Require returns the named argument, failing the shortcode if it is
+// missing.
+func (a ShortcodeArgs) Require(name string) (string, error) {
+	v, ok := a.Params[name]
+	if !ok || v == "" {
+		return "", missingArgError(name)
+	}
+	return v, nil
+}
+
+// missingArgError is returned by ShortcodeArgs.Require.
+type missingArgError string
+
+func (e missingArgError) Error() string { return "missing " + string(e) + "=" }
+
+var (
+	shortcodeMu      sync.Mutex
+	shortcodes       = map[string]*template.Template{}
+	shortcodeSources = map[string]string{} // name → template source, to detect changes
+)
+
+// templateLineRe extracts the line from a template parse error such as
+// `template: note.html:3: unexpected "}" in operand`.
+var templateLineRe = regexp.MustCompile(`template: [^:]+:(\d+):`)
+
+// SetShortcodes loads the built-in shortcodes and every <name>.html in dir,
+// which override built-ins of the same name. A missing dir leaves only the
+// built-ins. Cached posts are parsed again if any shortcode changed.
+func SetShortcodes(dir string) error {
+	sources := map[string]string{}
+	files := map[string]string{}
+	for name, src := range builtinShortcodes {
+		sources[name] = src
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(p), ".html")
+		sources[name], files[name] = string(b), p
+	}
+
+	tmpls := make(map[string]*template.Template, len(sources))
+	for name, src := range sources {
+		t, err := template.New(name).Option("missingkey=zero").Parse(src)
+		if err != nil {
+			if file := files[name]; file != "" {
+				line := 0
+				if m := templateLineRe.FindStringSubmatch(err.Error()); m != nil {
+					line, _ = strconv.Atoi(m[1])
+				}
+				return &Error{File: file, Line: line, Err: err}
+			}
+			return err
+		}
+		tmpls[name] = t
+	}
+
+	shortcodeMu.Lock()
+	changed := fmt.Sprint(sources) != fmt.Sprint(shortcodeSources)
+	shortcodes, shortcodeSources = tmpls, sources
+	shortcodeMu.Unlock()
+	if changed {
+		cacheMu.Lock()
+		cache = map[string]cachedPost{}
+		cacheMu.Unlock()
+	}
+	return nil
+}
+
+// shortcodeNames lists the known shortcodes, for error messages.
+func shortcodeNames() string {
+	shortcodeMu.Lock()
+	defer shortcodeMu.Unlock()
+	names := make([]string, 0, len(shortcodes))
+	for n := range shortcodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// shortcodeErrKey holds the first *Error met while expanding shortcodes.
+var shortcodeErrKey = parser.NewContextKey()
+
+// shortcodeArgRe matches one argument: name="value", name='value',
+// name=value, "value" or value.
+var shortcodeArgRe = regexp.MustCompile(`^(?:([\w-]+)=)?(?:"((?:[^"\\]|\\.)*)"|'([^']*)'|(\S+))`)
+
+// parseShortcode splits the inside of {{< … >}} into its name and arguments.
+func parseShortcode(s string) (ShortcodeArgs, error) {
+	s = strings.TrimSpace(s)
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ShortcodeArgs{}, fmt.Errorf("empty shortcode")
+	}
+	args := ShortcodeArgs{Name: fields[0], Params: map[string]string{}}
+	rest := strings.TrimSpace(s[len(fields[0]):])
+	for rest != "" {
+		m := shortcodeArgRe.FindStringSubmatch(rest)
+		if m == nil {
+			return args, fmt.Errorf("shortcode %s: cannot parse arguments at %q", args.Name, rest)
+		}
+		val := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[2]) + m[3] + m[4] // at most one is set
+		if m[1] != "" {
+			args.Params[m[1]] = val
+		} else {
+			args.Args = append(args.Args, val)
+		}
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+	return args, nil
+}
+
+// expandShortcode executes the shortcode written inside {{< … >}}.
+func expandShortcode(inner string) ([]byte, error) {
+	args, err := parseShortcode(inner)
+	if err != nil {
+		return nil, err
+	}
+	shortcodeMu.Lock()
+	t := shortcodes[args.Name]
+	shortcodeMu.Unlock()
+	if t == nil {
+		return nil, fmt.Errorf("unknown shortcode %q (known: %s)", args.Name, shortcodeNames())
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, args); err != nil {
+		var missing missingArgError
+		if errors.As(err, &missing) {
+			err = missing
+		}
+		return nil, fmt.Errorf("shortcode %s: %v", args.Name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+var kindShortcode = ast.NewNodeKind("Shortcode")
+
+// shortcodeNode is an expanded shortcode, or the literal text of an escaped
+// one.
+type shortcodeNode struct {
+	ast.BaseInline
+	html  []byte
+	block bool // alone in its paragraph, which it replaces
+}
+
+func (n *shortcodeNode) Kind() ast.NodeKind { return kindShortcode }
+
+func (n *shortcodeNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"HTML": string(n.html)}, nil)
+}
+
+type shortcodeParser struct{}
+
+func (shortcodeParser) Trigger() []byte { return []byte{'{'} }
+
+func (shortcodeParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("{{<")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte(">}}"))
+	if end < 0 {
+		return nil
+	}
+	inner := string(line[3:end])
+	block.Advance(end + 3)
+
+	if strings.HasPrefix(inner, "/*") && strings.HasSuffix(inner, "*/") {
+		literal := "{{<" + strings.TrimSuffix(strings.TrimPrefix(inner, "/*"), "*/") + ">}}"
+		return &shortcodeNode{html: util.EscapeHTML([]byte(literal))}
+	}
+	html, err := expandShortcode(inner)
+	if err != nil {
+		if pc.Get(shortcodeErrKey) == nil {
+			pc.Set(shortcodeErrKey, &Error{Line: lineAt(block.Source(), segment.Start, pc), Err: err})
+		}
+		return ast.NewTextSegment(segment.WithStop(segment.Start + end + 3))
+	}
+	return &shortcodeNode{html: html}
+}
+
+// shortcodeTransformer lifts shortcodes that are alone in a paragraph out of
+// it, so a figure or embed is not wrapped in <p>.
+type shortcodeTransformer struct{}
+
+func (shortcodeTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var paras []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if p, ok := n.(*ast.Paragraph); ok && entering {
+			paras = append(paras, p)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, p := range paras {
+		sc, ok := p.FirstChild().(*shortcodeNode)
+		if !ok || p.ChildCount() != 1 {
+			continue
+		}
+		sc.block = true
+		p.Parent().ReplaceChild(p.Parent(), p, sc)
+	}
+}
+
+type shortcodeRenderer struct{}
+
+func (shortcodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindShortcode, renderShortcode)
+}
+
+func renderShortcode(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		sc := n.(*shortcodeNode)
+		w.Write(sc.html)
+		if sc.block {
+			w.WriteByte('\n')
+		}
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type shortcodeExt struct{}
+
+func (shortcodeExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(shortcodeParser{}, 90)),
+		parser.WithASTTransformers(util.Prioritized(shortcodeTransformer{}, 700)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(shortcodeRenderer{}, 500)))
+}
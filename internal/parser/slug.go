@@ -0,0 +1,51 @@
+package parser
+
+import "strings"
+
+// foldings maps accented lowercase letters (Latin-1 and Vietnamese) to
+// their ASCII base letter.
+var foldings = map[rune]rune{}
+
+func init() {
+	for base, accented := range map[rune]string{
+		'a': "àáâãäåảạăằắẳẵặầấẩẫậ",
+		'c': "ç",
+		'd': "đ",
+		'e': "èéêëẻẽẹềếểễệ",
+		'i': "ìíîïỉĩị",
+		'n': "ñ",
+		'o': "òóôõöøỏọơờớởỡợồốổỗộ",
+		'u': "ùúûüủũụưừứửữự",
+		'y': "ýÿỳỷỹỵ",
+	} {
+		for _, r := range accented {
+			foldings[r] = base
+		}
+	}
+}
+
+// Slugify turns a title or file name into a URL-safe slug: lowercase ASCII
+// letters and digits separated by single hyphens. "Học Go (Part 2)" becomes
+// "hoc-go-part-2".
+func Slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if f, ok := foldings[r]; ok {
+			r = f
+		}
+		if r >= 0x300 && r <= 0x36f {
+			continue // combining accent from decomposed input
+		}
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
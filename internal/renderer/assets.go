@@ -0,0 +1,84 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// asset is a published static file as seen by templates.
+type asset struct {
+	URL       string // fingerprinted URL path, e.g. "/style.1a2b3c4d.css"
+	Integrity string // SRI hash, empty for assets served from elsewhere
+}
+
+// fingerprinted lists the extensions that get a content hash in their file
+// name. Everything else (robots.txt, favicon.ico, CNAME) keeps a stable URL.
+var fingerprinted = map[string]bool{
+	".css": true, ".js": true, ".mjs": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".avif": true,
+	".woff": true, ".woff2": true, ".ttf": true,
+}
+
+// publishAsset writes b to the output directory under its logical name (a
+// slash-separated path such as "style.css" or "vendor/fuse.min.js"),
+// fingerprinting the file name when the type is cacheable, and records it
+// for the "asset" and "integrity" template functions. Minification happens
+// first so the hash covers the bytes actually served. source is the file the
+// asset was read from.
+func (r *Renderer) publishAsset(name, source string, b []byte) (string, error) {
+	b = r.minified(name, b)
+	rel := name
+	if fingerprinted[strings.ToLower(path.Ext(name))] {
+		rel = path.Join(path.Dir(name), fingerprint(path.Base(name), b))
+	}
+	dst := filepath.Join(r.outputDir, filepath.FromSlash(rel))
+	if err := r.claim(dst, source); err != nil {
+		return "", err
+	}
+	if err := r.writeOutput(dst, b); err != nil {
+		return "", err
+	}
+	sum := sha512.Sum384(b)
+	r.assets[name] = asset{
+		URL:       "/" + rel,
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+	return "/" + rel, nil
+}
+
+// assetURL resolves a logical asset name to its fingerprinted URL.
+// Names the pipeline has not seen are returned as root-relative paths
+// unchanged, for files that other tools write into the output directory.
+func (r *Renderer) assetURL(name string) string {
+	if a, ok := r.assets[name]; ok {
+		return a.URL
+	}
+	return "/" + strings.TrimPrefix(name, "/")
+}
+
+// assetIntegrity returns the SRI value for a logical asset name, or "" if
+// the asset is unknown or served from a third-party origin.
+func (r *Renderer) assetIntegrity(name string) string {
+	return r.assets[name].Integrity
+}
+
+// assetCrossOrigin reports whether a logical asset is served from another
+// origin, such as a vendor asset's upstream URL when it could not be cached.
+// Those need crossorigin="anonymous" for their integrity to be checked.
+func (r *Renderer) assetCrossOrigin(name string) bool {
+	u := r.assets[name].URL
+	return strings.Contains(u, "://") || strings.HasPrefix(u, "//")
+}
+
+// fingerprint inserts a short content hash before the extension of name:
+// "fuse.min.js" becomes "fuse.min.1a2b3c4d.js".
+func fingerprint(name string, b []byte) string {
+	sum := sha256.Sum256(b)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:])[:8] + ext
+}
@@ -0,0 +1,129 @@
+package renderer
+
+import "portfolio/internal/model"
+
+// Language is a language the site is published in. The first configured
+// language is the default and is served without a URL prefix; the others
+// live under /<code>/.
+type Language struct {
+	Code string // BCP 47 code used in URLs and lang attributes, e.g. "vi"
+	Name string // name in the language itself, e.g. "Tiếng Việt"
+}
+
+// defaultLanguages is used when Options.Languages is empty.
+var defaultLanguages = []Language{{Code: "en", Name: "English"}}
+
+// pageContext is the language state of the page being rendered, read by
+// the lang, t, langURL, languages and translations template functions.
+type pageContext struct {
+	lang       string            // "" means the default language
+	alternates map[string]string // language code → URL path of this page in it
+}
+
+// LanguageLink is one entry of a language switcher or hreflang list.
+type LanguageLink struct {
+	Language
+	URL     string // URL path of the current page in this language
+	Current bool
+}
+
+// languages returns the configured languages, default first.
+func (r *Renderer) languages() []Language {
+	if len(r.opts.Languages) == 0 {
+		return defaultLanguages
+	}
+	return r.opts.Languages
+}
+
+// defaultLang returns the code of the default language.
+func (r *Renderer) defaultLang() string {
+	return r.languages()[0].Code
+}
+
+// langPrefix returns the URL prefix of lang: "" for the default language,
+// "/vi" for Vietnamese.
+func (r *Renderer) langPrefix(lang string) string {
+	if lang == "" || lang == r.defaultLang() {
+		return ""
+	}
+	return "/" + lang
+}
+
+// currentLang is the "lang" template function.
+func (r *Renderer) currentLang() string {
+	if r.page.lang == "" {
+		return r.defaultLang()
+	}
+	return r.page.lang
+}
+
+// translate is the "t" template function: the UI string key in the current
+// language, falling back to the default language and then the key itself.
+func (r *Renderer) translate(key string) string {
+	return r.translateIn(r.currentLang(), key)
+}
+
+func (r *Renderer) translateIn(lang, key string) string {
+	if s, ok := r.opts.Strings[lang][key]; ok {
+		return s
+	}
+	if s, ok := r.opts.Strings[r.defaultLang()][key]; ok {
+		return s
+	}
+	return key
+}
+
+// langURL is the "langURL" template function: path under the current
+// language's prefix.
+func (r *Renderer) langURL(path string) string {
+	return r.langPrefix(r.currentLang()) + path
+}
+
+// languageLinks is the "languages" template function, for the language
+// switcher: every language with the URL of this page in it, or of that
+// language's blog index when the page has no translation.
+func (r *Renderer) languageLinks() []LanguageLink {
+	links := make([]LanguageLink, 0, len(r.languages()))
+	for _, l := range r.languages() {
+		u, ok := r.page.alternates[l.Code]
+		if !ok {
+			u = r.langPrefix(l.Code) + "/blog/"
+		}
+		links = append(links, LanguageLink{Language: l, URL: u, Current: l.Code == r.currentLang()})
+	}
+	return links
+}
+
+// translationLinks is the "translations" template function, for hreflang
+// alternates: the languages this page really exists in, or nothing if it
+// exists in only one.
+func (r *Renderer) translationLinks() []LanguageLink {
+	if len(r.page.alternates) < 2 {
+		return nil
+	}
+	var links []LanguageLink
+	for _, l := range r.languages() {
+		if u, ok := r.page.alternates[l.Code]; ok {
+			links = append(links, LanguageLink{Language: l, URL: u, Current: l.Code == r.currentLang()})
+		}
+	}
+	return links
+}
+
+// postContext is the language context of a post page.
+func postContext(p model.Post) pageContext {
+	alts := map[string]string{p.Lang: p.URLPath()}
+	for _, t := range p.Translations {
+		alts[t.Lang] = t.URLPath()
+	}
+	return pageContext{lang: p.Lang, alternates: alts}
+}
+
+// pageContextOf is the language context of a standalone page.
+func pageContextOf(p model.Page) pageContext {
+	alts := map[string]string{p.Lang: p.URLPath()}
+	for _, t := range p.Translations {
+		alts[t.Lang] = t.URLPath()
+	}
+	return pageContext{lang: p.Lang, alternates: alts}
+}
@@ -0,0 +1,188 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MinifyStats reports how much the minification stage saved in a build.
+type MinifyStats struct {
+	Files  int
+	Before int64
+	After  int64
+}
+
+var (
+	htmlCommentRe  = regexp.MustCompile(`(?s)<!--(?:[^\[].*?)?-->`)
+	whitespaceRe   = regexp.MustCompile(`\s+`)
+	htmlBlockTagRe = regexp.MustCompile(`(?i)\s*(</?(?:html|head|body|meta|link|title|base|div|p|ul|ol|li|dl|dt|dd|nav|main|section|article|aside|header|footer|h[1-6]|table|thead|tbody|tfoot|tr|td|th|form|fieldset|details|summary|figure|figcaption|blockquote|hr|br|svg|script|style|pre|textarea|noscript)\b[^>]*>)\s*`)
+	// cssTokenRe matches the parts of a stylesheet minifyCSS must not touch:
+	// comments (dropped), quoted strings and url() (copied as they are).
+	cssTokenRe   = regexp.MustCompile(`(?s)/\*.*?\*/|(?i:url)\(\s*(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[^)]*)\s*\)|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	cssPunctRe   = regexp.MustCompile(`\s*([{};,>])\s*`)
+	cssColonRe   = regexp.MustCompile(`:\s+`)
+	xmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	xmlBetweenRe = regexp.MustCompile(`>\s+<`)
+)
+
+// rawOpenRe matches the opening tag of an element whose contents must not
+// have whitespace collapsed: preformatted text, code, scripts, styles, and
+// TeX math (a % starts a TeX comment that runs to the end of the line).
+var rawOpenRe = regexp.MustCompile(`(?i)<(pre|textarea|script|style|code)[\s>]|<(span|div)\s[^>]*\bclass="math[\s"]`)
+
+// minified returns b minified according to the extension of name when
+// minification is enabled, and records the savings. Files that are already
+// minified upstream (*.min.js, *.min.css) are passed through.
+func (r *Renderer) minified(name string, b []byte) []byte {
+	if !r.opts.Minify || strings.Contains(path.Base(name), ".min.") {
+		return b
+	}
+	var out []byte
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		out = []byte(minifyHTML(string(b)))
+	case ".css":
+		out = []byte(minifyCSS(string(b)))
+	case ".js", ".mjs":
+		out = []byte(minifyJS(string(b)))
+	case ".json":
+		out = minifyJSON(b)
+	case ".xml", ".svg":
+		out = []byte(minifyXML(string(b)))
+	default:
+		return b
+	}
+	r.minStats.Files++
+	r.minStats.Before += int64(len(b))
+	r.minStats.After += int64(len(out))
+	return out
+}
+
+// MinifyStats returns the totals for every file minified so far.
+func (r *Renderer) MinifyStats() MinifyStats {
+	return r.minStats
+}
+
+// minifyHTML strips comments and collapses insignificant whitespace while
+// leaving <pre>, <textarea>, <code> and math untouched. Inline <script> and <style>
+// bodies are handed to the JS/CSS minifiers.
+func minifyHTML(s string) string {
+	var out strings.Builder
+	for s != "" {
+		start, tag := nextRawTag(s)
+		if start < 0 {
+			out.WriteString(collapseHTML(s))
+			break
+		}
+		out.WriteString(collapseHTML(s[:start]))
+		s = s[start:]
+
+		openEnd := strings.IndexByte(s, '>')
+		closeIdx := strings.Index(strings.ToLower(s), "</"+tag)
+		if openEnd < 0 || closeIdx < openEnd {
+			out.WriteString(s)
+			break
+		}
+		open, body := s[:openEnd+1], s[openEnd+1:closeIdx]
+		out.WriteString(collapseHTML(open))
+		switch tag {
+		case "script":
+			if strings.Contains(open, "ld+json") {
+				body = string(minifyJSON([]byte(body)))
+			} else {
+				body = minifyJS(body)
+			}
+		case "style":
+			body = minifyCSS(body)
+		}
+		out.WriteString(body)
+		s = s[closeIdx:]
+	}
+	return out.String()
+}
+
+// nextRawTag finds the earliest opening tag matched by rawOpenRe in s and
+// returns its position and lower-case name.
+func nextRawTag(s string) (int, string) {
+	m := rawOpenRe.FindStringSubmatchIndex(s)
+	if m == nil {
+		return -1, ""
+	}
+	name := m[2:4]
+	if name[0] < 0 {
+		name = m[4:6]
+	}
+	return m[0], strings.ToLower(s[name[0]:name[1]])
+}
+
+// collapseHTML minifies an HTML fragment that contains no raw-text elements.
+func collapseHTML(s string) string {
+	s = htmlCommentRe.ReplaceAllString(s, "")
+	s = whitespaceRe.ReplaceAllString(s, " ")
+	return htmlBlockTagRe.ReplaceAllString(s, "$1")
+}
+
+// minifyCSS removes comments and whitespace around CSS punctuation. Quoted
+// strings and url() are copied unchanged: `content: " , "` and
+// `[title="a b"]` mean what they say.
+func minifyCSS(s string) string {
+	var out, text strings.Builder // text: CSS since the last string or url()
+	flush := func() {
+		t := whitespaceRe.ReplaceAllString(text.String(), " ")
+		t = cssPunctRe.ReplaceAllString(t, "$1")
+		t = cssColonRe.ReplaceAllString(t, ":")
+		out.WriteString(strings.ReplaceAll(t, ";}", "}"))
+		text.Reset()
+	}
+	last := 0
+	for _, m := range cssTokenRe.FindAllStringIndex(s, -1) {
+		text.WriteString(s[last:m[0]])
+		last = m[1]
+		if strings.HasPrefix(s[m[0]:], "/*") {
+			continue
+		}
+		flush()
+		out.WriteString(s[m[0]:m[1]])
+	}
+	text.WriteString(s[last:])
+	flush()
+	return strings.TrimSpace(out.String())
+}
+
+// minifyJS is deliberately conservative: without a real parser it only
+// drops indentation, blank lines and whole-line // comments, keeping line
+// breaks so automatic semicolon insertion is unaffected. Scripts using
+// template literals are left alone since their whitespace is significant.
+func minifyJS(s string) string {
+	if strings.Contains(s, "`") {
+		return s
+	}
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// minifyJSON compacts b, returning it unchanged if it is not valid JSON.
+func minifyJSON(b []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, bytes.TrimSpace(b)); err != nil {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// minifyXML strips comments and whitespace between tags (RSS, sitemaps, SVG).
+func minifyXML(s string) string {
+	s = xmlCommentRe.ReplaceAllString(s, "")
+	s = xmlBetweenRe.ReplaceAllString(s, "><")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,108 @@
+package renderer
+
+import "testing"
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"whitespace and comments",
+			"<div>\n  <p>a   b</p>\n  <!-- note -->\n</div>",
+			"<div><p>a b</p></div>",
+		},
+		{
+			"conditional comment kept",
+			"<p>a</p><!--[if IE]>x<![endif]-->",
+			"<p>a</p><!--[if IE]>x<![endif]-->",
+		},
+		{
+			"pre",
+			"<p>a</p>\n<pre>x   y\n  z</pre>\n<p>b</p>",
+			"<p>a</p><pre>x   y\n  z</pre><p>b</p>",
+		},
+		{
+			"inline code",
+			"<p>run  <code>a  |  b</code>  now</p>",
+			"<p>run <code>a  |  b</code> now</p>",
+		},
+		{
+			"display math",
+			"<div class=\"math math-display\">$$\na + b % comment\n$$</div>\n<p>x</p>",
+			"<div class=\"math math-display\">$$\na + b % comment\n$$</div><p>x</p>",
+		},
+		{
+			"inline math",
+			"<p>so <span class=\"math math-inline\">$a  \\\\\n b$</span>  ok</p>",
+			"<p>so <span class=\"math math-inline\">$a  \\\\\n b$</span> ok</p>",
+		},
+		{
+			"other span",
+			"<span class=\"mathematics\">a   b</span>",
+			"<span class=\"mathematics\">a b</span>",
+		},
+		{
+			"prefix of a raw tag",
+			"<codeblock>a   b</codeblock>",
+			"<codeblock>a b</codeblock>",
+		},
+		{
+			"style and script bodies",
+			"<style>\na { color: red ; }\n</style>\n<script>\n  // c\n  x()\n</script>",
+			"<style>a{color:red}</style><script>x()</script>",
+		},
+		{
+			"json-ld",
+			"<script type=\"application/ld+json\">\n{ \"a\" : 1 }\n</script>",
+			"<script type=\"application/ld+json\">{\"a\":1}</script>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minifyHTML(tt.in); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"punctuation", "a , b > c {\n  color: red ;\n  margin: 0  auto;\n}", "a,b>c{color:red;margin:0 auto}"},
+		{"comment", "a { x: 1; /* gone; } */ }", "a{x:1}"},
+		{"string", `a::after { content: " , " ; }`, `a::after{content:" , "}`},
+		{"single-quoted string", `a { font-family: 'A  B' , serif; }`, `a{font-family:'A  B',serif}`},
+		{"escaped quote", `a { content: "x\" ; y"; }`, `a{content:"x\" ; y"}`},
+		{"attribute selector", `[title="a b"] > p { x: 1 }`, `[title="a b"]>p{x:1}`},
+		{"comment in string", `a { content: "/* not a comment */"; }`, `a{content:"/* not a comment */"}`},
+		{"url", `a { background: url( "x y.png" ) no-repeat , url(data:a;b,c) ; }`, `a{background:url( "x y.png" ) no-repeat,url(data:a;b,c)}`},
+		{"unquoted url", `@font-face { src: url(f.woff2) format("woff2"); }`, `@font-face{src:url(f.woff2) format("woff2")}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minifyCSS(tt.in); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"indentation and comments", "function f() {\n  // why\n\n  return 1\n}\n", "function f() {\nreturn 1\n}"},
+		{"line breaks kept", "a = 1\nb = 2", "a = 1\nb = 2"},
+		{"template literal", "x = `a\n  b`", "x = `a\n  b`"},
+		{"trailing comment kept", "x() // call", "x() // call"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minifyJS(tt.in); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,72 +1,125 @@
 package renderer
 
 import (
+	"bytes"
 	"embed"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"html/template"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"portfolio/internal/i18n"
 	"portfolio/internal/model"
 )
 
-const siteURL = "https://rainyinsaigon.github.io"
+// defaultBaseURL is the production site root used when Options.BaseURL is empty.
+const defaultBaseURL = "https://rainyinsaigon.github.io"
 
-//go:embed templates
-var templateFS embed.FS
+//go:embed templates static
+var embeddedFS embed.FS
 
-//go:embed static
-var staticFS embed.FS
+// Options configures optional renderer features.
+type Options struct {
+	BaseURL   string        // absolute site root for feeds, sitemaps and og:url
+	SourceDir string        // read templates/ and static/ from disk instead of the embedded copies
+	AssetDirs []string      // extra asset sources, e.g. compiled Tailwind CSS
+	Minify    bool          // minify HTML/CSS/JS/JSON/XML/SVG output
+	Vendor    []VendorAsset // third-party assets served from /vendor/
+	VendorDir string        // local cache for Vendor, e.g. "third_party"
+	Languages []Language    // site languages, default first; English only if empty
+	Strings   i18n.Catalog  // translated UI strings for the "t" template function
+}
 
 // Renderer renders HTML pages using embedded templates.
 type Renderer struct {
 	outputDir string
+	siteURL   string // absolute site root without trailing slash
+	opts      Options
+	src       fs.FS // holds templates/ and static/
 	tmpl      *template.Template
+	assets    map[string]asset  // logical asset name → published file
+	claims    map[string]string // output path → source that wrote it
+	page      pageContext       // language of the page being rendered
+	minStats  MinifyStats
 }
 
 // New creates a Renderer that writes pages to outputDir.
-// Templates are parsed from the embedded templates/ directory.
-func New(outputDir string) (*Renderer, error) {
-	tmpl, err := template.ParseFS(templateFS, "templates/*.html")
+// Templates are parsed from the embedded templates/ directory, or from
+// opts.SourceDir on disk when set (the dev server, so edits apply live).
+func New(outputDir string, opts Options) (*Renderer, error) {
+	r := &Renderer{outputDir: outputDir, opts: opts, src: embeddedFS, assets: map[string]asset{}, claims: map[string]string{}}
+	r.siteURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if r.siteURL == "" {
+		r.siteURL = defaultBaseURL
+	}
+	if opts.SourceDir != "" {
+		r.src = os.DirFS(opts.SourceDir)
+	}
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"absURL":       r.absURL,
+		"asset":        r.assetURL,
+		"integrity":    r.assetIntegrity,
+		"crossorigin":  r.assetCrossOrigin,
+		"vendor":       r.vendorURL,
+		"lang":         r.currentLang,
+		"t":            r.translate,
+		"langURL":      r.langURL,
+		"languages":    r.languageLinks,
+		"translations": r.translationLinks,
+	}).ParseFS(r.src, "templates/*.html")
 	if err != nil {
 		return nil, err
 	}
-	return &Renderer{outputDir: outputDir, tmpl: tmpl}, nil
+	r.tmpl = tmpl
+	return r, nil
 }
 
-// CopyStaticFiles copies all files in static/ into the output directory.
+// CopyStaticFiles publishes all files in static/ and in the configured
+// asset directories into the output directory through the asset pipeline.
 func (r *Renderer) CopyStaticFiles() error {
-	return fs.WalkDir(staticFS, "static", func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(r.src, "static", func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		rel, _ := filepath.Rel("static", path)
-		dst := filepath.Join(r.outputDir, rel)
-
-		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-			return err
-		}
-		src, err := staticFS.Open(path)
+		b, err := fs.ReadFile(r.src, path)
 		if err != nil {
 			return err
 		}
-		defer src.Close()
-
-		f, err := os.Create(dst)
+		_, err = r.publishAsset(strings.TrimPrefix(path, "static/"), path, b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range r.opts.AssetDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == dir {
+				return fs.SkipDir // optional, e.g. Tailwind not compiled yet
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			_, err = r.publishAsset(filepath.ToSlash(rel), path, b)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-
-		_, err = io.Copy(f, src)
-		return err
-	})
+	}
+	return nil
 }
 
 // RenderHome renders the site home page.
@@ -84,16 +137,21 @@ func (r *Renderer) RenderHome(posts []model.Post, projects []model.Project) erro
 	}
 
 	data := model.HomeData{Posts: recent, Projects: featured}
-	return r.write(filepath.Join(r.outputDir, "index.html"), "home", data)
+	return r.write(filepath.Join(r.outputDir, "index.html"), "home page", "home", data)
 }
 
-// RenderBlogList renders the /blog index page.
-func (r *Renderer) RenderBlogList(posts []model.Post) error {
+// RenderBlogList renders the /blog index page of lang, e.g. /vi/blog/.
+func (r *Renderer) RenderBlogList(lang string, posts []model.Post) error {
 	data := struct{ Posts []model.Post }{Posts: posts}
-	return r.write(filepath.Join(r.outputDir, "blog", "index.html"), "blog_list", data)
+	ctx := pageContext{lang: lang, alternates: map[string]string{}}
+	for _, l := range r.languages() {
+		ctx.alternates[l.Code] = r.langPrefix(l.Code) + "/blog/"
+	}
+	return r.writeIn(ctx, r.pagePath(r.langPrefix(lang)+"/blog/"), "blog index", "blog_list", data)
 }
 
-// RenderPost renders an individual blog post page to /blog/<slug>/index.html.
+// RenderPost renders an individual blog post page to /blog/<slug>/index.html,
+// or to its url: override.
 // idx is the post's position in the sorted posts slice so prev/next can be computed.
 func (r *Renderer) RenderPost(posts []model.Post, idx int) error {
 	post := posts[idx]
@@ -106,33 +164,41 @@ func (r *Renderer) RenderPost(posts []model.Post, idx int) error {
 		prev := posts[idx-1]
 		data.Prev = &prev
 	}
-	relURLPath := strings.Trim(post.URLPath(), "/")
-	dir := filepath.Join(r.outputDir, filepath.FromSlash(relURLPath))
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	return r.write(filepath.Join(dir, "index.html"), "blog_post", data)
+	return r.writeIn(postContext(post), r.pagePath(post.URLPath()), post.Source, "blog_post", data)
+}
+
+// RenderPage renders a standalone page to /<slug>/index.html, or to its
+// url: override.
+func (r *Renderer) RenderPage(page model.Page) error {
+	return r.writeIn(pageContextOf(page), r.pagePath(page.URLPath()), page.Source, "page", page)
+}
+
+// RenderAlias writes a redirect page at the URL path from that sends
+// browsers and crawlers on to the URL path to. source is the file that
+// declared the alias.
+func (r *Renderer) RenderAlias(from, to, source string) error {
+	return r.write(r.pagePath(from), "alias in "+source, "alias", r.absURL(to))
 }
 
 // RenderWorks renders the /works page.
 func (r *Renderer) RenderWorks(projects []model.Project) error {
 	data := struct{ Projects []model.Project }{Projects: projects}
-	return r.write(filepath.Join(r.outputDir, "works", "index.html"), "works", data)
+	return r.write(filepath.Join(r.outputDir, "works", "index.html"), "works page", "works", data)
 }
 
 // RenderAbout renders the /about page.
 func (r *Renderer) RenderAbout() error {
-	return r.write(filepath.Join(r.outputDir, "about", "index.html"), "about", nil)
+	return r.write(filepath.Join(r.outputDir, "about", "index.html"), "about page", "about", nil)
 }
 
 // Render404 renders a custom 404 error page.
 func (r *Renderer) Render404() error {
-	return r.write(filepath.Join(r.outputDir, "404.html"), "notfound", nil)
+	return r.write(filepath.Join(r.outputDir, "404.html"), "404 page", "notfound", nil)
 }
 
 // RenderSearch renders the /search page.
 func (r *Renderer) RenderSearch() error {
-	return r.write(filepath.Join(r.outputDir, "search", "index.html"), "search", nil)
+	return r.write(filepath.Join(r.outputDir, "search", "index.html"), "search page", "search", nil)
 }
 
 // GenerateSearchJSON writes docs/search.json for browser-side Fuse.js search.
@@ -143,6 +209,7 @@ func (r *Renderer) GenerateSearchJSON(posts []model.Post) error {
 			Title:       p.Title,
 			Slug:        p.Slug,
 			URL:         p.URLPath(),
+			Lang:        p.Lang,
 			Description: p.Description,
 			Date:        p.Date,
 			Tags:        p.Tags,
@@ -153,12 +220,12 @@ func (r *Renderer) GenerateSearchJSON(posts []model.Post) error {
 	if err != nil {
 		return err
 	}
-	dst := filepath.Join(r.outputDir, "search.json")
-	return os.WriteFile(dst, b, 0644)
+	return r.writeFile(filepath.Join(r.outputDir, "search.json"), "search index", b)
 }
 
-// GenerateRSS writes docs/rss.xml as an RSS 2.0 feed.
-func (r *Renderer) GenerateRSS(posts []model.Post) error {
+// GenerateRSS writes the RSS 2.0 feed of lang, docs/rss.xml for the default
+// language and docs/<lang>/rss.xml for the others.
+func (r *Renderer) GenerateRSS(lang string, posts []model.Post) error {
 	type Item struct {
 		Title       string `xml:"title"`
 		Link        string `xml:"link"`
@@ -182,19 +249,24 @@ func (r *Renderer) GenerateRSS(posts []model.Post) error {
 	for i, p := range posts {
 		items[i] = Item{
 			Title:       p.Title,
-			Link:        fmt.Sprintf("%s%s", siteURL, p.URLPath()),
-			PubDate:     p.DateParsed.UTC().Format(time.RFC1123Z),
+			Link:        fmt.Sprintf("%s%s", r.siteURL, p.URLPath()),
+			PubDate:     p.DateParsed.Format(time.RFC1123Z),
 			Description: p.Description,
 		}
 	}
 
+	// Only the default language has a home page; the others link their blog.
+	link := r.siteURL
+	if prefix := r.langPrefix(lang); prefix != "" {
+		link += prefix + "/blog/"
+	}
 	feed := RSS{
 		Version: "2.0",
 		Channel: Channel{
 			Title:       "RainyinSaiGon",
-			Link:        siteURL,
-			Description: "Software engineering, cloud, and explainable AI — by RainyinSaiGon",
-			Language:    "en",
+			Link:        link,
+			Description: r.translateIn(lang, "feed.description"),
+			Language:    lang,
 			Items:       items,
 		},
 	}
@@ -204,37 +276,149 @@ func (r *Renderer) GenerateRSS(posts []model.Post) error {
 		return err
 	}
 	content := append([]byte(xml.Header), out...)
-	return os.WriteFile(filepath.Join(r.outputDir, "rss.xml"), content, 0644)
+	rel := strings.TrimPrefix(r.langPrefix(lang)+"/rss.xml", "/")
+	return r.writeFile(filepath.Join(r.outputDir, filepath.FromSlash(rel)), "RSS feed", content)
+}
+
+// GenerateAtom writes the Atom feed of lang next to its RSS feed, as
+// atom.xml. Unlike RSS it carries when each post was last updated.
+func (r *Renderer) GenerateAtom(lang string, posts []model.Post) error {
+	type Link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type Entry struct {
+		Title     string `xml:"title"`
+		Link      Link   `xml:"link"`
+		ID        string `xml:"id"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Summary   string `xml:"summary,omitempty"`
+	}
+	type Feed struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Lang     string   `xml:"xml:lang,attr"`
+		Title    string   `xml:"title"`
+		Subtitle string   `xml:"subtitle"`
+		ID       string   `xml:"id"`
+		Links    []Link   `xml:"link"`
+		Updated  string   `xml:"updated"`
+		Author   string   `xml:"author>name"`
+		Entries  []Entry  `xml:"entry"`
+	}
+
+	prefix := r.langPrefix(lang)
+	home := r.siteURL + "/"
+	if prefix != "" {
+		home = r.siteURL + prefix + "/blog/"
+	}
+	rel := strings.TrimPrefix(prefix+"/atom.xml", "/")
+	feed := Feed{
+		Lang:     lang,
+		Title:    "RainyinSaiGon",
+		Subtitle: r.translateIn(lang, "feed.description"),
+		ID:       home,
+		Links:    []Link{{Href: r.siteURL + "/" + rel, Rel: "self"}, {Href: home}},
+		Updated:  newest(posts).Format(time.RFC3339),
+		Author:   "RainyinSaiGon",
+	}
+	for _, p := range posts {
+		u := r.siteURL + p.URLPath()
+		feed.Entries = append(feed.Entries, Entry{
+			Title:     p.Title,
+			Link:      Link{Href: u},
+			ID:        u,
+			Published: p.DateParsed.Format(time.RFC3339),
+			Updated:   p.Lastmod.Format(time.RFC3339),
+			Summary:   p.Description,
+		})
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	content := append([]byte(xml.Header), out...)
+	return r.writeFile(filepath.Join(r.outputDir, filepath.FromSlash(rel)), "Atom feed", content)
+}
+
+// newest returns the latest Lastmod of posts, or the current time if there
+// are none.
+func newest(posts []model.Post) time.Time {
+	var t time.Time
+	for _, p := range posts {
+		if p.Lastmod.After(t) {
+			t = p.Lastmod
+		}
+	}
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
 }
 
-// GenerateSitemap writes docs/sitemap.xml.
-func (r *Renderer) GenerateSitemap(posts []model.Post, projects []model.Project) error {
+// GenerateSitemap writes the sitemap of lang, docs/sitemap.xml for the
+// default language (which also lists the pages that exist only in it) and
+// docs/<lang>/sitemap.xml for the others. Every URL with translations lists
+// them as hreflang alternates.
+func (r *Renderer) GenerateSitemap(lang string, posts []model.Post, pages []model.Page, projects []model.Project) error {
+	type Link struct {
+		Rel      string `xml:"rel,attr"`
+		Hreflang string `xml:"hreflang,attr"`
+		Href     string `xml:"href,attr"`
+	}
 	type URL struct {
 		Loc        string `xml:"loc"`
 		LastMod    string `xml:"lastmod,omitempty"`
 		ChangeFreq string `xml:"changefreq,omitempty"`
 		Priority   string `xml:"priority,omitempty"`
+		Alternates []Link `xml:"xhtml:link"`
 	}
 	type URLSet struct {
 		XMLName xml.Name `xml:"urlset"`
 		XMLNS   string   `xml:"xmlns,attr"`
+		XHTML   string   `xml:"xmlns:xhtml,attr,omitempty"`
 		URLs    []URL    `xml:"url"`
 	}
+	alternates := func(ctx pageContext) []Link {
+		if len(ctx.alternates) < 2 {
+			return nil
+		}
+		var links []Link
+		for _, l := range r.languages() {
+			if u, ok := ctx.alternates[l.Code]; ok {
+				links = append(links, Link{Rel: "alternate", Hreflang: l.Code, Href: r.siteURL + u})
+			}
+		}
+		return links
+	}
 
-	today := time.Now().UTC().Format("2006-01-02")
-	urls := []URL{
-		{Loc: siteURL + "/", ChangeFreq: "weekly", Priority: "1.0", LastMod: today},
-		{Loc: siteURL + "/blog/", ChangeFreq: "weekly", Priority: "0.9", LastMod: today},
-		{Loc: siteURL + "/works/", ChangeFreq: "monthly", Priority: "0.8"},
-		{Loc: siteURL + "/about/", ChangeFreq: "monthly", Priority: "0.7"},
-		{Loc: siteURL + "/search/", ChangeFreq: "monthly", Priority: "0.5"},
+	// The home page and blog lists change whenever a post they show does.
+	updated := newest(posts).Format("2006-01-02")
+	var urls []URL
+	if lang == r.defaultLang() {
+		urls = []URL{
+			{Loc: r.siteURL + "/", ChangeFreq: "weekly", Priority: "1.0", LastMod: updated},
+			{Loc: r.siteURL + "/works/", ChangeFreq: "monthly", Priority: "0.8"},
+			{Loc: r.siteURL + "/about/", ChangeFreq: "monthly", Priority: "0.7"},
+			{Loc: r.siteURL + "/search/", ChangeFreq: "monthly", Priority: "0.5"},
+		}
+	}
+	blog := pageContext{alternates: map[string]string{}}
+	for _, l := range r.languages() {
+		blog.alternates[l.Code] = r.langPrefix(l.Code) + "/blog/"
+	}
+	urls = append(urls, URL{Loc: r.siteURL + r.langPrefix(lang) + "/blog/", ChangeFreq: "weekly", Priority: "0.9", LastMod: updated, Alternates: alternates(blog)})
+	for _, p := range pages {
+		urls = append(urls, URL{Loc: r.siteURL + p.URLPath(), ChangeFreq: "monthly", Priority: "0.6", Alternates: alternates(pageContextOf(p))})
 	}
 	for _, p := range posts {
 		urls = append(urls, URL{
-			Loc:        fmt.Sprintf("%s%s", siteURL, p.URLPath()),
-			LastMod:    p.DateParsed.UTC().Format("2006-01-02"),
+			Loc:        fmt.Sprintf("%s%s", r.siteURL, p.URLPath()),
+			LastMod:    p.Lastmod.Format("2006-01-02"),
 			ChangeFreq: "yearly",
 			Priority:   "0.7",
+			Alternates: alternates(postContext(p)),
 		})
 	}
 
@@ -242,23 +426,60 @@ func (r *Renderer) GenerateSitemap(posts []model.Post, projects []model.Project)
 		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
 		URLs:  urls,
 	}
+	if len(r.languages()) > 1 {
+		set.XHTML = "http://www.w3.org/1999/xhtml"
+	}
 	out, err := xml.MarshalIndent(set, "", "  ")
 	if err != nil {
 		return err
 	}
 	content := append([]byte(xml.Header), out...)
-	return os.WriteFile(filepath.Join(r.outputDir, "sitemap.xml"), content, 0644)
+	rel := strings.TrimPrefix(r.langPrefix(lang)+"/sitemap.xml", "/")
+	return r.writeFile(filepath.Join(r.outputDir, filepath.FromSlash(rel)), "sitemap", content)
 }
 
-// write creates all necessary directories and executes the named template into path.
-func (r *Renderer) write(path, tmplName string, data any) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+// absURL turns a root-relative path into an absolute URL on the site.
+func (r *Renderer) absURL(path string) string {
+	return r.siteURL + "/" + strings.TrimPrefix(path, "/")
+}
+
+// pagePath returns the index.html file in the output directory that serves
+// the directory-style URL path urlPath.
+func (r *Renderer) pagePath(urlPath string) string {
+	rel := strings.Trim(urlPath, "/")
+	return filepath.Join(r.outputDir, filepath.FromSlash(rel), "index.html")
+}
+
+// writeIn is write for a page in a particular language.
+func (r *Renderer) writeIn(ctx pageContext, path, source, tmplName string, data any) error {
+	r.page = ctx
+	defer func() { r.page = pageContext{} }()
+	return r.write(path, source, tmplName, data)
+}
+
+// write executes the named template and writes the result to path on
+// behalf of source.
+func (r *Renderer) write(path, source, tmplName string, data any) error {
+	var buf bytes.Buffer
+	if err := r.tmpl.ExecuteTemplate(&buf, tmplName, data); err != nil {
 		return err
 	}
-	f, err := os.Create(path)
-	if err != nil {
+	return r.writeFile(path, source, buf.Bytes())
+}
+
+// writeFile claims path for source, minifies b (when enabled) and writes it.
+func (r *Renderer) writeFile(path, source string, b []byte) error {
+	if err := r.claim(path, source); err != nil {
+		return err
+	}
+	return r.writeOutput(path, r.minified(path, b))
+}
+
+// writeOutput creates all necessary directories and writes b to path.
+// Every file the renderer produces goes through here.
+func (r *Renderer) writeOutput(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
-	defer f.Close()
-	return r.tmpl.ExecuteTemplate(f, tmplName, data)
+	return os.WriteFile(path, b, 0644)
 }
@@ -0,0 +1,24 @@
+package renderer
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// claim records that source produces the output file path, failing if a
+// different source already wrote it: two posts with the same slug, or a
+// post whose url: lands on /works/, would otherwise silently overwrite each
+// other. The same source may claim a path again (a font referenced twice
+// by one stylesheet).
+func (r *Renderer) claim(path, source string) error {
+	rel, err := filepath.Rel(r.outputDir, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	if owner, ok := r.claims[rel]; ok && owner != source {
+		return fmt.Errorf("output path /%s is written by both %s and %s", rel, owner, source)
+	}
+	r.claims[rel] = source
+	return nil
+}
@@ -0,0 +1,158 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VendorAsset is a third-party file (script, stylesheet, font CSS) that is
+// fetched once into the local vendor cache and served from the site itself.
+type VendorAsset struct {
+	Name string // logical name used in templates, e.g. "fuse.min.js"
+	URL  string // upstream location, only fetched on a cache miss
+}
+
+// cssURLRe matches url(...) references inside vendored stylesheets, e.g. the
+// font files listed by the Google Fonts CSS API or the relative fonts/ paths
+// of KaTeX. data: URLs are left alone.
+var cssURLRe = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+
+// vendorClient is used for cache misses only; a committed cache directory
+// means a build never touches the network.
+var vendorClient = &http.Client{Timeout: 30 * time.Second}
+
+// CopyVendorFiles makes every configured vendor asset available under
+// /vendor/ in the output directory with a content-hashed file name, and
+// records the resulting URLs for the "vendor" template function.
+//
+// Assets missing from the cache are downloaded into it first. If that fails
+// (e.g. no network and nothing committed) the upstream URL is used instead so
+// the build still succeeds, and a warning is logged.
+func (r *Renderer) CopyVendorFiles() error {
+	for _, a := range r.opts.Vendor {
+		cached := filepath.Join(r.opts.VendorDir, a.Name)
+		if err := fetchOnce(cached, a.URL); err != nil {
+			log.Printf("vendor: %s not cached, falling back to %s: %v", a.Name, a.URL, err)
+			r.assets["vendor/"+a.Name] = asset{URL: a.URL}
+			continue
+		}
+		b, err := os.ReadFile(cached)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(a.Name, ".css") {
+			if b, err = r.vendorCSSResources(b, a.URL); err != nil {
+				return fmt.Errorf("%s: %w", a.Name, err)
+			}
+		}
+		if _, err := r.publishAsset("vendor/"+a.Name, cached, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vendorURL resolves a logical vendor asset name for templates.
+func (r *Renderer) vendorURL(name string) (string, error) {
+	a, ok := r.assets["vendor/"+name]
+	if !ok {
+		return "", fmt.Errorf("unknown vendor asset %q", name)
+	}
+	return a.URL, nil
+}
+
+// vendorCSSResources downloads (once) every url() referenced by a
+// stylesheet fetched from base, copies it into the output and rewrites the
+// reference. Relative references are resolved against base.
+func (r *Renderer) vendorCSSResources(css []byte, base string) ([]byte, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	out := cssURLRe.ReplaceAllFunc(css, func(m []byte) []byte {
+		ref, err := url.Parse(string(cssURLRe.FindSubmatch(m)[1]))
+		if err != nil || ref.Scheme == "data" {
+			return m
+		}
+		remote := baseURL.ResolveReference(ref).String()
+		sum := sha256.Sum256([]byte(remote))
+		name := hex.EncodeToString(sum[:])[:16] + path.Ext(strings.SplitN(remote, "?", 2)[0])
+		cached := filepath.Join(r.opts.VendorDir, "files", name)
+		if err := fetchOnce(cached, remote); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return m
+		}
+		b, err := os.ReadFile(cached)
+		if err == nil {
+			var urlPath string
+			if urlPath, err = r.publishAsset("vendor/"+name, cached, b); err == nil {
+				return []byte("url(" + urlPath + ")")
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		return m
+	})
+	return out, firstErr
+}
+
+// fetchOnce downloads url into dst unless dst already exists.
+func fetchOnce(dst, url string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// Google Fonts serves woff2 only to user agents it recognises.
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+	resp, err := vendorClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so an interrupted build never
+	// leaves a truncated asset in the cache.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
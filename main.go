@@ -2,26 +2,252 @@ package main
 
 import (
 	"flag"
-	"log"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	_ "time/tzdata" // the site time zone must resolve on machines without zoneinfo
 
 	"portfolio/internal/builder"
+	"portfolio/internal/parser"
+	"portfolio/internal/renderer"
 )
 
+// version is set at release time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// Exit codes shared by all commands.
+const (
+	exitOK    = 0
+	exitError = 1 // the command ran and failed (build error, broken links)
+	exitUsage = 2 // bad command line
+)
+
+// command is a portfolio subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// Assigned in init because runHelp refers back to commands.
+	commands = []command{
+		{"build", "generate the site into the output directory", runBuild},
+		{"serve", "run the dev server with live reload", runServe},
+		{"new", "create a post, project or page from a template", runNew},
+		{"check", "check links in the generated site", runCheck},
+		{"stats", "print content statistics", runStats},
+		{"clean", "remove generated files", runClean},
+		{"version", "print the version", runVersion},
+		{"help", "show this help", runHelp},
+	}
+}
+
 func main() {
-	dev := flag.Bool("dev", false, "run dev server with live reload on :3000")
-	flag.Parse()
+	args := os.Args[1:]
+	// "portfolio" and "portfolio -flags" keep meaning a build, so
+	// `go run .` in CI works unchanged.
+	if len(args) == 0 || (len(args[0]) > 1 && args[0][0] == '-' && args[0] != "-h" && args[0] != "--help") {
+		os.Exit(runBuild(args))
+	}
+	name := args[0]
+	if name == "-h" || name == "--help" {
+		name = "help"
+	}
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "portfolio: unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: portfolio <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'portfolio <command> -help' for the flags of a command.")
+}
+
+func runHelp(args []string) int {
+	usage()
+	return exitOK
+}
+
+// newFlagSet returns a flag set whose -help output names the command.
+func newFlagSet(name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: portfolio %s\n\nFlags:\n", strings.TrimSpace(name+" [flags] "+argsUsage))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args into fs and returns the exit code to use if the
+// command should stop: exitOK after -help, exitUsage on bad flags.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// siteFlags registers the flags shared by commands that read content or
+// write the site, and returns the config they fill in.
+func siteFlags(fs *flag.FlagSet) *builder.Config {
+	cfg := defaultConfig()
+	fs.StringVar(&cfg.ContentDir, "content", cfg.ContentDir, "content directory")
+	fs.StringVar(&cfg.OutputDir, "out", cfg.OutputDir, "output directory")
+	fs.StringVar(&cfg.BaseURL, "base-url", cfg.BaseURL, "absolute site URL used in feeds, sitemaps and og:url")
+	fs.BoolVar(&cfg.Drafts, "drafts", cfg.Drafts, "include posts and pages marked draft: true")
+	return &cfg
+}
 
-	cfg := builder.Config{
+// defaultConfig is the production site configuration.
+func defaultConfig() builder.Config {
+	return builder.Config{
 		ContentDir: "content",
 		OutputDir:  "docs",
+		BaseURL:    "https://rainyinsaigon.github.io",
+		AssetDirs:  []string{"assets/dist"},
+		Minify:     true,
+		Gzip:       true,
+		GzipMin:    1024,
+		VendorDir:  "third_party",
+		Related:    builder.RelatedConfig{Count: 3, TagWeight: 1, SeriesWeight: 0.5, TextWeight: 2},
+		Languages: []renderer.Language{
+			{Code: "en", Name: "English"},
+			{Code: "vi", Name: "Tiếng Việt"},
+		},
+		I18nDir:  "i18n",
+		TimeZone: "Asia/Ho_Chi_Minh",
+		Repo:     "https://github.com/RainyinSaiGon/RainyinSaiGon.github.io",
+		Branch:   "main",
+		History:  true,
+		Diagrams: map[string][]string{
+			"dot": {"dot", "-Tsvg"},
+			"d2":  {"d2", "-", "-"},
+		},
+		DiagramDir: "diagram-cache",
+		Shortcodes: "layouts/shortcodes",
+		HTML: parser.HTMLPolicy{
+			Mode: parser.HTMLSanitize,
+			Allow: map[string][]string{
+				"*":          {"class", "id", "title", "lang", "dir"},
+				"a":          {"href", "rel", "target"},
+				"abbr":       nil,
+				"audio":      {"src", "controls", "loop", "muted", "preload"},
+				"b":          nil,
+				"blockquote": {"cite"},
+				"br":         nil,
+				"code":       nil,
+				"dd":         nil,
+				"del":        {"datetime"},
+				"details":    {"open"},
+				"div":        nil,
+				"dl":         nil,
+				"dt":         nil,
+				"em":         nil,
+				"figcaption": nil,
+				"figure":     nil,
+				"hr":         nil,
+				"i":          nil,
+				"iframe":     {"src", "width", "height", "allow", "allowfullscreen", "loading", "referrerpolicy"},
+				"img":        {"src", "alt", "width", "height", "loading"},
+				"ins":        {"datetime"},
+				"kbd":        nil,
+				"li":         nil,
+				"mark":       nil,
+				"ol":         {"start", "reversed", "type"},
+				"p":          nil,
+				"picture":    nil,
+				"pre":        nil,
+				"s":          nil,
+				"small":      nil,
+				"source":     {"src", "srcset", "type", "media"},
+				"span":       nil,
+				"strong":     nil,
+				"sub":        nil,
+				"summary":    nil,
+				"sup":        nil,
+				"table":      nil,
+				"tbody":      nil,
+				"td":         {"colspan", "rowspan", "align"},
+				"th":         {"colspan", "rowspan", "align", "scope"},
+				"thead":      nil,
+				"tr":         nil,
+				"u":          nil,
+				"ul":         nil,
+				"video":      {"src", "poster", "controls", "width", "height", "autoplay", "loop", "muted", "playsinline", "preload"},
+			},
+		},
+		Vendor: []renderer.VendorAsset{
+			{Name: "google-sans.css", URL: "https://fonts.googleapis.com/css2?family=Google+Sans:wght@400;500;700&family=Google+Sans+Display:wght@400;700;900&display=swap"},
+			{Name: "fuse.min.js", URL: "https://cdn.jsdelivr.net/npm/fuse.js@7.0.0/dist/fuse.min.js"},
+			{Name: "highlight.min.js", URL: "https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.11.1/highlight.min.js"},
+			{Name: "atom-one-dark.min.css", URL: "https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.11.1/styles/atom-one-dark.min.css"},
+			{Name: "highlightjs-zig.min.js", URL: "https://cdn.jsdelivr.net/npm/highlightjs-zig@1.0.2/dist/zig.min.js"},
+			{Name: "mermaid.min.js", URL: "https://cdn.jsdelivr.net/npm/mermaid@11.4.1/dist/mermaid.min.js"},
+			{Name: "katex.min.css", URL: "https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.css"},
+			{Name: "katex.min.js", URL: "https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.js"},
+		},
 	}
+}
+
+func runBuild(args []string) int {
+	fs := newFlagSet("build", "")
+	cfg := siteFlags(fs)
+	fs.BoolVar(&cfg.Minify, "minify", cfg.Minify, "minify HTML, CSS, JS, JSON and XML output")
+	fs.BoolVar(&cfg.Gzip, "gzip", cfg.Gzip, "write precompressed .gz files")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := builder.Build(*cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "build:", err)
+		return exitError
+	}
+	return exitOK
+}
 
-	if *dev {
-		runDevServer(cfg)
-		return
+func runClean(args []string) int {
+	fs := newFlagSet("clean", "")
+	cfg := siteFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	n, err := builder.Clean(*cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "clean:", err)
+		return exitError
 	}
+	fmt.Printf("Removed %d generated file(s) from %s/\n", n, cfg.OutputDir)
+	return exitOK
+}
 
-	if err := builder.Build(cfg); err != nil {
-		log.Fatal(err)
+func runVersion(args []string) int {
+	fs := newFlagSet("version", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+				v += " (" + s.Value[:7] + ")"
+			}
+		}
 	}
+	fmt.Println("portfolio", v)
+	return exitOK
 }
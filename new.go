@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"portfolio/internal/builder"
+	"portfolio/internal/model"
+	"portfolio/internal/parser"
+)
+
+// archetypes are the repository's archetypes/<kind>.md, built in for
+// "portfolio new" when the archetype directory has no <kind>.md of its own
+// (e.g. -archetypes points elsewhere, or a file was deleted).
+//
+//go:embed archetypes/*.md
+var archetypes embed.FS
+
+// archetypeData is what an archetype template can refer to.
+type archetypeData struct {
+	Title   string
+	Date    string // today, YYYY-MM-DD
+	Section string // directory under posts/, e.g. "go"
+	Tags    string // comma-separated default tags
+	Series  string // series name, parts only
+	Part    int    // 1-based part number, parts only
+}
+
+// kindDirs maps a content kind to its directory under the content root.
+var kindDirs = map[string]string{"post": "posts", "part": "posts", "page": "pages", "project": "projects"}
+
+// partRe matches the part number in a series post's title or file name:
+// "(Part 2)", "(pt2)", "-pt2".
+var partRe = regexp.MustCompile(`(?i)\s*[(-]?\b(?:part\s*|pt)(\d+)\)?$`)
+
+// runNew implements "portfolio new post|project|page <name>" and
+// "portfolio new part <series>".
+func runNew(args []string) int {
+	fs := newFlagSet("new", "post|project|page [section/]<title> | part <series>")
+	cfg := siteFlags(fs)
+	dir := fs.String("archetypes", "archetypes", "directory of <kind>.md templates overriding the built-in ones")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 2 || kindDirs[fs.Arg(0)] == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	kind := fs.Arg(0)
+
+	var path string
+	var data archetypeData
+	var err error
+	if kind == "part" {
+		// Reading the series parses the posts, shortcodes and all.
+		if err = builder.SetupParser(*cfg); err == nil {
+			path, data, err = nextPart(filepath.Join(cfg.ContentDir, "posts"), fs.Arg(1))
+		}
+	} else {
+		path, data = newItem(filepath.Join(cfg.ContentDir, kindDirs[kind]), kind, fs.Arg(1))
+	}
+	if err == nil {
+		var loc *time.Location
+		if loc, err = time.LoadLocation(cfg.TimeZone); err == nil {
+			data.Date = time.Now().In(loc).Format("2006-01-02")
+		}
+		var body string
+		if body, err = renderArchetype(*dir, kind, data); err == nil {
+			err = createFile(path, body)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "new:", err)
+		return exitError
+	}
+	fmt.Println("Created", path)
+	return exitOK
+}
+
+// newItem works out the file and defaults for "new post go/My Post": the
+// title is the last path element (de-slugified if it looks like a slug),
+// the file name is its slug, and a post's section doubles as its tag.
+func newItem(dir, kind, name string) (string, archetypeData) {
+	name = strings.TrimSuffix(filepath.ToSlash(name), ".md")
+	section, title := "", name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		section, title = name[:i], name[i+1:]
+	}
+	if title == strings.ToLower(title) && !strings.Contains(title, " ") {
+		title = titleFromName(title)
+	}
+	data := archetypeData{Title: title, Section: section}
+	if kind == "post" && section != "" {
+		data.Tags = titleFromName(filepath.Base(section))
+	}
+	return filepath.Join(dir, filepath.FromSlash(section), parser.Slugify(title)+".md"), data
+}
+
+// nextPart finds the posts of series (matched by name or slug) under dir
+// and returns the file and defaults for the part after the last one, in the
+// same section and with the same tags.
+func nextPart(dir, series string) (string, archetypeData, error) {
+	posts, err := parser.ReadPosts(dir)
+	if err != nil {
+		return "", archetypeData{}, err
+	}
+	var parts []model.Post
+	known := map[string]bool{}
+	for _, p := range posts {
+		if p.SeriesTag == "" || p.Lang != "" {
+			continue // translations are not parts of their own
+		}
+		known[p.SeriesTag] = true
+		if strings.EqualFold(p.SeriesTag, series) || parser.Slugify(p.SeriesTag) == parser.Slugify(series) {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		names := make([]string, 0, len(known))
+		for s := range known {
+			names = append(names, fmt.Sprintf("%q", s))
+		}
+		sort.Strings(names)
+		return "", archetypeData{}, fmt.Errorf("no series %q (existing: %s)", series, strings.Join(names, ", "))
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if !parts[i].DateParsed.Equal(parts[j].DateParsed) {
+			return parts[i].DateParsed.Before(parts[j].DateParsed)
+		}
+		return parts[i].Source < parts[j].Source
+	})
+	last := parts[len(parts)-1]
+	n := len(parts) + 1
+
+	title := last.Title
+	if partRe.MatchString(title) {
+		title = partRe.ReplaceAllString(title, fmt.Sprintf(" (Part %d)", n))
+	} else {
+		title = fmt.Sprintf("%s (Part %d)", last.SeriesTag, n)
+	}
+	base := partRe.ReplaceAllString(last.Slug, "")
+	if base == "" {
+		base = last.SeriesTag
+	}
+	data := archetypeData{
+		Title:   title,
+		Section: last.Path,
+		Tags:    strings.Join(last.Tags, ", "),
+		Series:  last.SeriesTag,
+		Part:    n,
+	}
+	file := parser.Slugify(fmt.Sprintf("%s pt%d", base, n)) + ".md"
+	return filepath.Join(dir, filepath.FromSlash(last.Path), file), data, nil
+}
+
+// renderArchetype executes dir/<kind>.md, or the built-in archetype if that
+// file does not exist.
+func renderArchetype(dir, kind string, data archetypeData) (string, error) {
+	name := filepath.Join(dir, kind+".md")
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		name = "archetypes/" + kind + ".md"
+		b, err = archetypes.ReadFile(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// createFile writes content to a new file, refusing to overwrite.
+func createFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// titleFromName turns "my-first_post" into "My First Post".
+func titleFromName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+	for i, w := range words {
+		r := []rune(w)
+		words[i] = strings.ToUpper(string(r[0])) + string(r[1:])
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"portfolio/internal/builder"
+	"portfolio/internal/parser"
+)
+
+// runStats implements "portfolio stats": a summary of the content tree.
+func runStats(args []string) int {
+	fs := newFlagSet("stats", "")
+	cfg := siteFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if err := builder.SetupParser(*cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "stats:", err)
+		return exitError
+	}
+	posts, err := parser.ReadPosts(filepath.Join(cfg.ContentDir, "posts"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stats:", err)
+		return exitError
+	}
+	pages, err := parser.ReadPages(filepath.Join(cfg.ContentDir, "pages"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stats:", err)
+		return exitError
+	}
+	projects, err := parser.ReadProjects(filepath.Join(cfg.ContentDir, "projects"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stats:", err)
+		return exitError
+	}
+
+	drafts, minutes := 0, 0
+	tags := map[string]int{}
+	series := map[string]int{}
+	years := map[int]int{}
+	for _, p := range posts {
+		if p.Draft {
+			drafts++
+		}
+		minutes += p.ReadTime
+		for _, t := range p.Tags {
+			tags[t]++
+		}
+		if p.SeriesTag != "" {
+			series[p.SeriesTag]++
+		}
+		if !p.DateParsed.IsZero() {
+			years[p.DateParsed.Year()]++
+		}
+	}
+
+	fmt.Printf("Posts:     %d (%d draft)\n", len(posts), drafts)
+	fmt.Printf("Pages:     %d\n", len(pages))
+	fmt.Printf("Projects:  %d\n", len(projects))
+	fmt.Printf("Read time: %d min total", minutes)
+	if len(posts) > 0 {
+		fmt.Printf(", %.1f min per post", float64(minutes)/float64(len(posts)))
+	}
+	fmt.Println()
+
+	if len(years) > 0 {
+		ys := make([]int, 0, len(years))
+		for y := range years {
+			ys = append(ys, y)
+		}
+		sort.Ints(ys)
+		parts := make([]string, len(ys))
+		for i, y := range ys {
+			parts[i] = fmt.Sprintf("%d: %d", y, years[y])
+		}
+		fmt.Printf("By year:   %s\n", strings.Join(parts, ", "))
+	}
+	if len(series) > 0 {
+		fmt.Printf("Series:    %s\n", strings.Join(ranked(series, 0), ", "))
+	}
+	if len(tags) > 0 {
+		fmt.Printf("Top tags:  %s\n", strings.Join(ranked(tags, 10), ", "))
+	}
+	return exitOK
+}
+
+// ranked formats counts as "name (n)" sorted by count, then name, keeping at
+// most limit entries (0 for all).
+func ranked(counts map[string]int, limit int) []string {
+	names := make([]string, 0, len(counts))
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = fmt.Sprintf("%s (%d)", n, counts[n])
+	}
+	return out
+}
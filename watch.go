@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"portfolio/internal/builder"
+)
+
+const (
+	pollInterval = 300 * time.Millisecond
+	// debounceDelay batches the burst of events an editor produces for a
+	// single save (write temp file, rename, chmod, ...) into one rebuild.
+	debounceDelay = 100 * time.Millisecond
+)
+
+// ignoredNames are base-name patterns for editor swap, backup and temp
+// files that should never trigger a rebuild.
+var ignoredNames = []string{
+	"*.swp", "*.swo", "*.swx", "4913", // vim
+	"*~", ".#*", "#*#", // emacs and friends
+	"*.tmp", "*___jb_tmp___", "*___jb_old___", // JetBrains safe-write
+	".DS_Store", "Thumbs.db",
+}
+
+// ignoredDirs are never watched.
+var ignoredDirs = map[string]bool{".git": true, "node_modules": true}
+
+func ignored(path string) bool {
+	base := filepath.Base(path)
+	for _, pat := range ignoredNames {
+		if ok, _ := filepath.Match(pat, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// watchFiles rebuilds the site whenever a source file changes. It uses
+// the platform's file notification API where available and falls back to
+// polling otherwise.
+func watchFiles(cfg builder.Config) {
+	roots := []string{cfg.ContentDir, "internal"}
+	for _, dir := range append([]string{cfg.I18nDir, cfg.Shortcodes}, cfg.AssetDirs...) {
+		if _, err := os.Stat(dir); err == nil {
+			roots = append(roots, dir)
+		}
+	}
+
+	events, err := notifyChanges(roots)
+	if err != nil {
+		log.Printf("file notifications unavailable (%v), polling every %s", err, pollInterval)
+		events = pollChanges(roots, pollInterval)
+	}
+
+	pending := map[string]bool{}
+	var flush <-chan time.Time
+	for {
+		select {
+		case path := <-events:
+			if ignored(path) {
+				continue
+			}
+			pending[path] = true
+			flush = time.After(debounceDelay)
+		case <-flush:
+			changed := make([]string, 0, len(pending))
+			for p := range pending {
+				changed = append(changed, p)
+			}
+			sort.Strings(changed)
+			pending = map[string]bool{}
+			flush = nil
+			rebuild(cfg, changed)
+		}
+	}
+}
+
+// rebuild rebuilds the site for a batch of changed paths, re-parsing only the
+// changed content (see builder.Rebuild), and tells the connected browsers
+// about the outcome.
+func rebuild(cfg builder.Config, changed []string) {
+	log.Printf("changed: %v", changed)
+	err := builder.Rebuild(cfg, changed)
+	switch {
+	case errors.Is(err, builder.ErrRestartRequired):
+		log.Printf("%v", err)
+	case err != nil:
+		log.Printf("rebuild error: %v", err)
+		broadcastError(err)
+	default:
+		kind := reloadKind(cfg, changed)
+		log.Printf("rebuilt (%s reload)", kind)
+		broadcast(kind)
+	}
+}
+
+// pollChanges walks roots every interval and reports paths whose
+// modification time changed, appeared or disappeared.
+func pollChanges(roots []string, interval time.Duration) <-chan string {
+	out := make(chan string)
+	go func() {
+		prev := takeSnapshot(roots)
+		for range time.Tick(interval) {
+			cur := takeSnapshot(roots)
+			for p, t := range cur {
+				if old, ok := prev[p]; !ok || !old.Equal(t) {
+					out <- p
+				}
+			}
+			for p := range prev {
+				if _, ok := cur[p]; !ok {
+					out <- p
+				}
+			}
+			prev = cur
+		}
+	}()
+	return out
+}
+
+func takeSnapshot(dirs []string) map[string]time.Time {
+	snap := map[string]time.Time{}
+	for _, dir := range dirs {
+		_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if ignoredDirs[info.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			snap[path] = info.ModTime()
+			return nil
+		})
+	}
+	return snap
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// notifyChanges watches every directory under roots with inotify and
+// reports the paths of files that change. Directories created later are
+// added to the watch as they appear.
+func notifyChanges(roots []string) (<-chan string, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[int]string{} // watch descriptor → directory
+
+	addTree := func(root string) error {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			if ignoredDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+			dirs[wd] = path
+			return nil
+		})
+	}
+	for _, root := range roots {
+		if err := addTree(root); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
+
+	out := make(chan string)
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err != nil {
+				if err == syscall.EINTR {
+					continue
+				}
+				log.Printf("inotify: %v", err)
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+				if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					out <- roots[0] // events were lost; rebuild anyway
+					continue
+				}
+				dir, ok := dirs[int(ev.Wd)]
+				if !ok {
+					continue
+				}
+				if ev.Mask&syscall.IN_IGNORED != 0 {
+					delete(dirs, int(ev.Wd))
+					continue
+				}
+				path := filepath.Join(dir, cString(nameBytes))
+				if ev.Mask&syscall.IN_ISDIR != 0 && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					if err := addTree(path); err != nil {
+						log.Printf("inotify: watching %s: %v", path, err)
+					}
+				}
+				out <- path
+			}
+		}
+	}()
+	return out, nil
+}
+
+// cString trims the NUL padding inotify appends to event names.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
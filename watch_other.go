@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// notifyChanges is only implemented on Linux; other platforms poll.
+func notifyChanges(roots []string) (<-chan string, error) {
+	return nil, errors.New("not supported on this platform")
+}